@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jakexks/go-providence-checker/pkg/checker"
+	"github.com/jakexks/go-providence-checker/pkg/dirutil"
+)
+
+// rootModule is a root module given on the command line along with the
+// state it was initialized with and the modules of its build list.
+type rootModule struct {
+	// arg is the root as given on the command line.
+	arg     string
+	state   checker.State
+	modules []checker.GoModuleInfo
+}
+
+// key is unique among the root modules of a run.
+func (r rootModule) key() string {
+	root := r.state.Root()
+	return checker.ModuleVersion{Path: root.Path, Version: root.Version}.String()
+}
+
+// bundleLayout gives where the artifacts of a bundle are written.
+type bundleLayout struct {
+	licenses, thirdparty, firstparty string
+}
+
+// in returns the layout with the relative paths made relative to dir.
+func (l bundleLayout) in(dir string) bundleLayout {
+	join := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	return bundleLayout{licenses: join(l.licenses), thirdparty: join(l.thirdparty), firstparty: join(l.firstparty)}
+}
+
+// relative returns the layout with the absolute paths replaced by their
+// base name, so that it can be used for several bundles.
+func (l bundleLayout) relative() bundleLayout {
+	base := func(path string) string {
+		if filepath.IsAbs(path) {
+			return filepath.Base(path)
+		}
+		return path
+	}
+	return bundleLayout{licenses: base(l.licenses), thirdparty: base(l.thirdparty), firstparty: base(l.firstparty)}
+}
+
+func (l bundleLayout) paths() []string {
+	return []string{l.licenses, l.thirdparty, l.firstparty}
+}
+
+// prepareOutput refuses to clobber the existing files and non-empty
+// directories at the given paths, unless overwrite is true in which case
+// they are removed.
+func prepareOutput(paths []string, overwrite bool) error {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("while checking the output '%s': %w", path, err)
+		}
+
+		empty := info.Size() == 0
+		if info.IsDir() {
+			entries, err := ioutil.ReadDir(path)
+			if err != nil {
+				return fmt.Errorf("while checking the output '%s': %w", path, err)
+			}
+			empty = len(entries) == 0
+		}
+		if empty {
+			continue
+		}
+
+		if !overwrite {
+			return fmt.Errorf("the output '%s' already exists and is not empty. Run with --overwrite to replace it.", path)
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("while removing the existing output '%s': %w", path, err)
+		}
+	}
+	return nil
+}
+
+// bundle is what is distributed along with the binaries: the LICENSES.txt
+// file, the source code of the dependencies under the thirdparty directory
+// and the source code of the root modules under the firstparty directory.
+type bundle struct {
+	layout   bundleLayout
+	licenses *os.File
+
+	// The license file is rendered with the template once every module
+	// has been added.
+	tmpl        checker.AttributionTemplate
+	attribution checker.Attribution
+
+	// firstparty holds the roots that were already copied.
+	firstparty map[string]struct{}
+
+	// except holds the absolute paths that must never be copied into the
+	// firstparty directory, such as the bundle itself when a root module
+	// is the current directory.
+	except []string
+}
+
+// The root and whether the license texts are grouped are given by the
+// attribution.
+func newBundle(layout bundleLayout, attribution checker.Attribution, tmpl checker.AttributionTemplate, except []string) (*bundle, error) {
+	dir := filepath.Dir(layout.licenses)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("mkdir -p %s: %w", dir, err)
+	}
+	licenses, err := os.OpenFile(layout.licenses, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %w", layout.licenses, err)
+	}
+	attribution.Modules = []checker.AttributedModule{}
+	return &bundle{
+		layout:      layout,
+		licenses:    licenses,
+		tmpl:        tmpl,
+		attribution: attribution,
+		firstparty:  make(map[string]struct{}),
+		except:      except,
+	}, nil
+}
+
+func (b *bundle) Close() error {
+	return b.licenses.Close()
+}
+
+// add adds the license texts of the module to the license file. When
+// copySource is true, the source code that the license requires to
+// distribute is copied: the module's for a reciprocal license, and also
+// the code of the roots that need the module for a restricted license.
+func (b *bundle) add(li checker.LicenseInfo, roots []rootModule, copySource bool) error {
+	mod := fmt.Sprintf("%s@%s", li.LibraryName, li.LibraryVersion)
+	m, err := checker.NewAttributedModule(li)
+	if err != nil {
+		return fmt.Errorf("module %s: %w", mod, err)
+	}
+	b.attribution.Modules = append(b.attribution.Modules, m)
+	if !copySource {
+		return nil
+	}
+
+	switch li.LicenseType {
+	case "reciprocal":
+		dstPath := filepath.Join(b.layout.thirdparty, li.LibraryName)
+		os.MkdirAll(dstPath, 0755)
+		err := dirutil.CopyDirectory(li.SourceDir, dstPath)
+		if err != nil {
+			return fmt.Errorf("while copying the source code for the dependency '%s' due to the reprocical license %s, copying '%s' into '%s': %w", mod, li.LicenseName, li.SourceDir, dstPath, err)
+		}
+	case "restricted":
+		dstPath := filepath.Join(b.layout.thirdparty, li.LibraryName)
+		os.MkdirAll(dstPath, 0755)
+		err := dirutil.CopyDirectory(li.SourceDir, dstPath)
+		if err != nil {
+			return fmt.Errorf("while copying the source code of the dependency '%s' due to its restricted license %s: copying dir '%s' into '%s': %w", mod, li.LicenseName, li.SourceDir, dstPath, err)
+		}
+
+		// We need to copy the source code of the modules given by the
+		// user, since this restricted dependency requires source code
+		// to be distributed.
+		for _, root := range roots {
+			if err := b.copyFirstparty(root); err != nil {
+				return fmt.Errorf("while copying the root's source code (%s) due to the restricted license %s of the dependency '%s': %w", root.arg, li.LicenseName, mod, err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeLicenses renders the license file. It returns the NOTICE files that
+// the template did not reproduce.
+func (b *bundle) writeLicenses() ([]checker.MissingNotice, error) {
+	b.attribution.Complete()
+	var rendered bytes.Buffer
+	if err := b.tmpl.Execute(&rendered, b.attribution); err != nil {
+		return nil, fmt.Errorf("while rendering %s: %w", b.licenses.Name(), err)
+	}
+	if _, err := b.licenses.Write(rendered.Bytes()); err != nil {
+		return nil, fmt.Errorf("while writing %s: %w", b.licenses.Name(), err)
+	}
+	return b.attribution.MissingNotices(b.tmpl)
+}
+
+// copyFirstparty copies the source code of the root module once, or of
+// every module of the workspace when the root is a go.work file.
+func (b *bundle) copyFirstparty(root rootModule) error {
+	for _, m := range root.state.Firstparty() {
+		if err := b.copyModule(root, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bundle) copyModule(root rootModule, m checker.GoModuleInfo) error {
+	key := checker.ModuleVersion{Path: m.Path, Version: m.Version}.String()
+	if _, found := b.firstparty[key]; found {
+		return nil
+	}
+	b.firstparty[key] = struct{}{}
+
+	// A binary built from a local checkout doesn't tell where the source
+	// code of its main module is.
+	if m.Dir == "" {
+		return fmt.Errorf("the source code of the root module %s could not be found", m.Path)
+	}
+
+	dstPath := filepath.Join(b.layout.firstparty, m.Path)
+	if err := os.MkdirAll(dstPath, 0755); err != nil {
+		return fmt.Errorf("mkdir -p %s: %w", dstPath, err)
+	}
+
+	// When the root module is a local checkout, the current directory may
+	// well be the root module itself, in which case we must not copy the
+	// output into itself.
+	var except []string
+	if checker.IsLocalPath(root.arg) {
+		git, err := absPaths(filepath.Join(m.Dir, ".git"))
+		if err != nil {
+			return err
+		}
+		except = append(git, b.except...)
+	}
+
+	if err := dirutil.CopyDirectoryExcept(m.Dir, dstPath, except...); err != nil {
+		return fmt.Errorf("while copying dir '%s' into '%s': %w", m.Dir, dstPath, err)
+	}
+	return nil
+}
@@ -1,14 +1,19 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jakexks/go-providence-checker/pkg/checker"
-	"github.com/jakexks/go-providence-checker/pkg/dirutil"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -18,10 +23,17 @@ var (
 	root = &cobra.Command{
 		Use:   "go-providence-checker",
 		Short: "ensure GCM compliance",
-		Long:  `Given a go module, find all dependencies and licenses.`,
+		Long: `Given a go module, find all dependencies and licenses.
+
+The module can either be given as a module path such as
+"github.com/jetstack/cert-manager@v1.3.0", in which case it is downloaded,
+or as a path to a local directory containing a go.mod such as "./" or
+"/src/cert-manager", in which case its go.mod and go.sum are used as-is.
+It can also be a path to a go.work file, in which case every module of the
+workspace is a root module.`,
 	}
 	check = &cobra.Command{
-		Use:   "check <module path>",
+		Use:   "check <module path | local dir>",
 		Short: "retrieve the licence for a specific module",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(_ *cobra.Command, args []string) error {
@@ -34,22 +46,126 @@ var (
 		},
 	}
 	checkAll = &cobra.Command{
-		Use:   "dependencies <module path>",
+		Use:   "dependencies <module path | local dir | go.work>...",
 		Short: "retrieve the licence for a all dependencies of a module",
-		Args:  cobra.ExactArgs(1),
+		Long: `Retrieve the licence for all the dependencies of one or several root
+modules. With several root modules, the union of their dependencies is
+classified once and an attribution bundle is produced for all the roots as
+well as for each root under roots/.
+
+With a go.work file, the combined dependencies of the modules of the
+workspace are classified, and the source code of every module of the
+workspace is copied when a restricted license requires it.`,
+		PreRunE: bindFlags,
 		RunE: func(_ *cobra.Command, args []string) error {
-			var s checker.State
-			if err := s.Init(args[0]); err != nil {
-				return fmt.Errorf("while initializing go-providence-checker: %w", err)
+			if path := viper.GetString("manifest"); path != "" {
+				fromManifest, err := checker.LoadManifest(path)
+				if err != nil {
+					return err
+				}
+				args = append(args, fromManifest...)
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("expected at least one module path or local dir, or a --manifest")
+			}
+
+			var roots []rootModule
+			for _, arg := range args {
+				var s checker.State
+				if err := s.Init(arg); err != nil {
+					return fmt.Errorf("while initializing go-providence-checker: %w", err)
+				}
+				defer s.Cleanup()
+				roots = append(roots, rootModule{arg: arg, state: s})
 			}
-			defer s.Cleanup()
 
 			// Cobra-specificity: runE should only return an error if this error
 			// is related to the usage of the CLI. Otherwise, the error must be
 			// handled and nil must be returned.
-			err := run(s, args[0])
+			var err error
+			for i := range roots {
+				roots[i].modules, err = listModules(roots[i].state)
+				if err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = run(roots)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			return nil
+		},
+	}
+	binary = &cobra.Command{
+		Use:   "binary <path>",
+		Short: "retrieve the licence for all the modules embedded in a compiled Go binary",
+		Long: `Read the build info embedded in a compiled Go binary to find the exact
+list of modules that were linked into it, and retrieve their licences.`,
+		Args:    cobra.ExactArgs(1),
+		PreRunE: bindFlags,
+		RunE: func(_ *cobra.Command, args []string) error {
+			var s checker.State
+			defer s.Cleanup()
+			gomodEntries, err := s.InitBinary(args[0])
+			if err == nil {
+				err = run([]rootModule{{arg: args[0], state: s, modules: gomodEntries}})
+			}
 			if err != nil {
-				fmt.Printf("Error: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			return nil
+		},
+	}
+	cachePrune = &cobra.Command{
+		Use:     "cache-prune",
+		Short:   "remove the cached classification results that were not used recently",
+		Args:    cobra.NoArgs,
+		PreRunE: bindFlags,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			dir := viper.GetString("cache-dir")
+			if dir == "" {
+				var err error
+				dir, err = checker.DefaultCacheDir()
+				if err != nil {
+					return err
+				}
+			}
+			cache, err := checker.OpenCache(dir)
+			if err != nil {
+				return err
+			}
+			removed, err := cache.Prune(viper.GetDuration("max-age"))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("removed %d cached results from %s\n", removed, dir)
+			return nil
+		},
+	}
+	image = &cobra.Command{
+		Use:   "image <OCI layout dir | tarball>",
+		Short: "retrieve the licence for all the modules of the Go binaries in a container image",
+		Long: `Find every Go binary in the layers of a container image and retrieve the
+licences of the modules linked into them, merged into a single attribution
+bundle. The image is either an OCI image layout directory or a tarball such
+as the output of 'docker save'.`,
+		Args:    cobra.ExactArgs(1),
+		PreRunE: bindFlags,
+		RunE: func(_ *cobra.Command, args []string) error {
+			var s checker.State
+			defer s.Cleanup()
+			gomodEntries, err := s.InitImage(args[0])
+			if err == nil {
+				err = run([]rootModule{{arg: args[0], state: s, modules: gomodEntries}})
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
 
@@ -62,10 +178,52 @@ func init() {
 	cobra.OnInitialize(flagsFromEnv)
 	root.PersistentFlags().BoolP("force", "f", false, "Ignore errors during go get")
 	root.PersistentFlags().BoolP("debug", "d", false, "Print commands being that are run in the background")
-	root.AddCommand(check, checkAll)
+	root.PersistentFlags().Float64("license-threshold", 0.9, "Confidence between 0 and 1 above which additional licenses found in a module are reported")
+	root.PersistentFlags().Bool("no-cache", false, "Classify every module again instead of using the results cached by the previous runs")
+	root.PersistentFlags().String("cache-dir", "", "Directory of the classification cache (default go-providence-checker in the user's cache directory)")
+	root.PersistentFlags().Bool("offline", false, "Never access the network: the modules are taken from the module cache or from the root module's vendor directory, and the run fails with the list of the missing modules")
+	root.PersistentFlags().String("extra-licenses-dir", "", "Directory of additional license texts, such as proprietary licenses, known to the licenseclassifier along with the embedded corpus. Each file is named after its license, e.g. ACME-1.0.txt")
+	root.PersistentFlags().String("custom-licenses", "", "Path to a YAML or JSON file registering the texts of custom licenses, such as proprietary licenses, along with their type and policy")
+	root.PersistentFlags().String("overrides", "", "Path to a YAML or JSON file asserting the license of modules that can't be detected or are misdetected")
+	addReportFlags(checkAll)
+	checkAll.Flags().String("manifest", "", "Path to a YAML or JSON file listing root modules under 'roots', in addition to the ones given as arguments")
+	checkAll.Flags().Bool("packages", false, "Only take into account the license files that govern the packages that are built, as given by 'go list -deps'")
+	checkAll.Flags().Bool("shipped-only", false, "Only keep the modules that are linked into the main packages for the target platform, leaving out the test-only and other-platform modules")
+	checkAll.Flags().StringSlice("main", nil, "Main packages to build, such as './cmd/controller' (default every package of the root module)")
+	checkAll.Flags().String("goos", "", "Target GOOS used to select the packages that are built (default the host's)")
+	checkAll.Flags().String("goarch", "", "Target GOARCH used to select the packages that are built (default the host's)")
+	checkAll.Flags().String("tags", "", "Comma-separated build tags used to select the packages that are built")
+	checkAll.Flags().Bool("vendor", false, "Read the dependencies of local root modules from their vendor/modules.txt and classify the vendored source code, without using the network or the module cache")
+	addReportFlags(binary)
+	addReportFlags(image)
+	image.Flags().String("goos", "", "GOOS of the image to pick from a multi-platform image (default linux)")
+	image.Flags().String("goarch", "", "GOARCH of the image to pick from a multi-platform image (default the host's)")
+	cachePrune.Flags().Duration("max-age", 30*24*time.Hour, "Remove the results that were not used for longer than this, or all the results when 0")
+	root.AddCommand(check, checkAll, binary, image, cachePrune)
 	viper.BindPFlags(root.PersistentFlags())
 }
 
+// addReportFlags adds the flags of the commands that call run.
+func addReportFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", "text", "Output format: 'text', 'json', 'spdx' (SPDX tag-value), 'spdx-json', 'cyclonedx' (CycloneDX JSON) or 'cyclonedx-xml'")
+	cmd.Flags().String("policy", "", "Path to a YAML or JSON license policy file with allow, deny and review lists")
+	cmd.Flags().String("output-dir", ".", "Directory in which the license file and the thirdparty and firstparty directories are written")
+	cmd.Flags().String("licenses-file", "LICENSES.txt", "Path of the license file, relative to --output-dir unless absolute")
+	cmd.Flags().String("thirdparty-dir", "thirdparty", "Path of the directory holding the source code of the dependencies, relative to --output-dir unless absolute")
+	cmd.Flags().String("firstparty-dir", "firstparty", "Path of the directory holding the source code of the root modules, relative to --output-dir unless absolute")
+	cmd.Flags().String("template", checker.TemplateText, "Template of the license file: 'text', 'markdown', 'html', or the path to a Go text/template file, or html/template file when its extension is .html")
+	cmd.Flags().Bool("group-licenses", false, "Reproduce each license text once along with the list of modules that use it. The texts that differ in their copyright lines are kept apart")
+	cmd.Flags().Bool("overwrite", false, "Replace the existing output instead of refusing to write into it")
+	cmd.Flags().Int("jobs", runtime.NumCPU(), "Number of modules classified in parallel")
+}
+
+// bindFlags binds the flags of the command being run. Since several
+// commands have flags with the same name, the flags can't all be bound
+// upfront.
+func bindFlags(cmd *cobra.Command, _ []string) error {
+	return viper.BindPFlags(cmd.Flags())
+}
+
 // flagsFromEnv allows flags to be set from environment variables.
 func flagsFromEnv() {
 	viper.SetEnvPrefix("go_providence_checker")
@@ -79,31 +237,219 @@ func Execute() {
 	}
 }
 
-// The checker state must have been already intialized with Init. The
-// rootMod is of the form "github.com/apache/thrift@v0.13.0".
-func run(s checker.State, rootMod string) error {
+// listModules returns the modules of the build list of the root module.
+func listModules(s checker.State) ([]checker.GoModuleInfo, error) {
 	gomodEntries, err := s.GoList()
 	if err != nil {
-		return fmt.Errorf("running checker.ListAll: %w", err)
+		return nil, fmt.Errorf("running checker.ListAll: %w", err)
 	}
-	licensestxt, err := os.OpenFile("LICENSES.txt", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+
+	// With --shipped-only, only the modules that are linked into the main
+	// packages are kept. With --packages, only the license files that
+	// govern the packages that are actually built are taken into account.
+	packages, shippedOnly := viper.GetBool("packages"), viper.GetBool("shipped-only")
+	if packages || shippedOnly {
+		mains := viper.GetStringSlice("main")
+		pkgs, err := s.GoListPackages(mains...)
+		if err != nil {
+			return nil, fmt.Errorf("while listing the packages of the build: %w", err)
+		}
+		if len(mains) > 0 {
+			if err := checker.CheckMainPackages(pkgs); err != nil {
+				return nil, err
+			}
+		}
+		if packages {
+			gomodEntries = checker.WithPackages(gomodEntries, pkgs)
+		} else {
+			gomodEntries = checker.Shipped(gomodEntries, pkgs)
+		}
+	}
+
+	return gomodEntries, nil
+}
+
+type classification struct {
+	li  checker.LicenseInfo
+	err error
+}
+
+// classifyAll classifies each module with the state of a root that
+// requires it, given at the same index, with a pool of jobs workers. The
+// results are in the order of the modules so that they can be reported,
+// and the source code copied, in the same order whatever the number of
+// jobs. The modules without source code to classify are skipped.
+func classifyAll(modules []checker.GoModuleInfo, states []*checker.State, jobs int) []classification {
+	results := make([]classification, len(modules))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if modules[i].Main && modules[i].Dir == "" {
+					continue
+				}
+				li, err := states[i].Classify(modules[i])
+				results[i] = classification{li: li, err: err}
+			}
+		}()
+	}
+	for i := range modules {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// run classifies the union of the modules of the roots once. The states of
+// the roots must have been already intialized with Init, InitBinary or
+// InitImage. A root is of the form "github.com/apache/thrift@v0.13.0" or is
+// a path to a local directory, to a binary or to an image.
+//
+// The LICENSES.txt file and the thirdparty and firstparty directories are
+// written in the --output-dir. When there are several roots, they cover all
+// the roots, and the same files are written for each root under
+// roots/<root module>, along with roots.json that gives the dependencies
+// that each root needs.
+func run(roots []rootModule) error {
+	// With a machine-readable --output, the human-readable lines are
+	// replaced by the report on stdout.
+	format := viper.GetString("output")
+	var out io.Writer = os.Stdout
+	switch format {
+	case "text":
+	case "json", "spdx", "spdx-json", "cyclonedx", "cyclonedx-xml":
+		out = ioutil.Discard
+	default:
+		return fmt.Errorf("unknown output format '%s', expected one of 'text', 'json', 'spdx', 'spdx-json', 'cyclonedx' or 'cyclonedx-xml'", format)
+	}
+	multi := len(roots) > 1
+	if multi && format != "text" && format != "json" {
+		return fmt.Errorf("the output format '%s' only supports a single root module", format)
+	}
+
+	var args []string
+	for _, root := range roots {
+		args = append(args, root.arg)
+	}
+	report := checker.NewReport(strings.Join(args, ", "))
+	s := roots[0].state
+	sbom := checker.NewSBOM(s.Root())
+
+	// When a policy file is given, it replaces the built-in policy that
+	// only allows restricted licenses when they are LGPL. The policies of
+	// the custom licenses apply in both cases.
+	custom := s.CustomLicenses()
+	sbom.Custom = custom
+	var policy *checker.Policy
+	if path := viper.GetString("policy"); path != "" {
+		p, err := checker.LoadPolicy(path)
+		if err != nil {
+			return err
+		}
+		p.AddCustomLicenses(custom)
+		policy = p
+	}
+	now := time.Now()
+
+	packages := viper.GetBool("packages")
+
+	// The union of the modules is kept in the order in which they appear
+	// in the roots. A module is classified with the state of the first
+	// root that requires it, since its Dir is given by this root, e.g. in
+	// its vendor directory. With --packages, the packages that each root
+	// builds are merged.
+	var union []checker.GoModuleInfo
+	var owners []*checker.State
+	index := make(map[string]int)
+	neededBy := make(map[string][]rootModule)
+	for r, root := range roots {
+		for _, entry := range root.modules {
+			key := checker.ModuleVersion{Path: entry.Path, Version: entry.Version}.String()
+			neededBy[key] = append(neededBy[key], root)
+			i, found := index[key]
+			if !found {
+				index[key] = len(union)
+				union = append(union, entry)
+				owners = append(owners, &roots[r].state)
+				continue
+			}
+			union[i].Packages = mergePackages(union[i].Packages, entry.Packages)
+		}
+	}
+
+	outputDir := viper.GetString("output-dir")
+	names := bundleLayout{
+		licenses:   viper.GetString("licenses-file"),
+		thirdparty: viper.GetString("thirdparty-dir"),
+		firstparty: viper.GetString("firstparty-dir"),
+	}
+	layout := names.in(outputDir)
+	outputs := layout.paths()
+	if multi {
+		outputs = append(outputs, filepath.Join(outputDir, "roots"), filepath.Join(outputDir, "roots.json"))
+	}
+	if err := prepareOutput(outputs, viper.GetBool("overwrite")); err != nil {
+		return err
+	}
+	except, err := absPaths(outputs...)
 	if err != nil {
-		return fmt.Errorf("creating LICENSES.txt: %w", err)
+		return err
 	}
-	defer licensestxt.Close()
-	seen := make(map[string]struct{})
-	for _, entry := range gomodEntries {
-		li, err := s.Classify(entry)
+	tmpl, err := checker.LoadAttributionTemplate(viper.GetString("template"))
+	if err != nil {
+		return err
+	}
+	grouped := viper.GetBool("group-licenses")
+	merged, err := newBundle(layout, checker.Attribution{Root: report.Root, Grouped: grouped}, tmpl, except)
+	if err != nil {
+		return err
+	}
+	defer merged.Close()
+
+	// The modules that can be distributed are kept for writing the bundle
+	// of each root. When copySource is false, the source code that the
+	// license requires to distribute is not copied.
+	type distributed struct {
+		li         checker.LicenseInfo
+		copySource bool
+	}
+	jobs := viper.GetInt("jobs")
+	if jobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1, got %d", jobs)
+	}
+	classified := classifyAll(union, owners, jobs)
+
+	results := make(map[string]distributed)
+	for i, entry := range union {
+		key := checker.ModuleVersion{Path: entry.Path, Version: entry.Version}.String()
+
+		// An image, or a binary built from a local checkout, has no
+		// source code to classify.
+		if entry.Main && entry.Dir == "" {
+			owners[i].Log.Infof("module %s: no source code to classify", entry.Path)
+			sbom.Add(entry, nil)
+			continue
+		}
+
+		li, err := classified[i].li, classified[i].err
 		switch {
 		case err == checker.ErrNoLicenseFileFound:
 			if viper.GetBool("force") {
-				s.Log.Infof("module %s@%s: no license file found in the directory '%s'", entry.Path, entry.Version, entry.Dir)
+				owners[i].Log.Infof("module %s@%s: no license file found in the directory '%s'", entry.Path, entry.Version, entry.Dir)
+				report.AddFailure(entry, err.Error())
+				sbom.Add(entry, nil)
 				continue
 			} else {
 				return fmt.Errorf("module %s@%s: no license file found in the directory '%s'. Run with --force to ignore.", entry.Path, entry.Version, entry.Dir)
 			}
 		case err != nil:
-			fmt.Printf("module %s@%s: no license detected, check + add manually\n", entry.Path, entry.Version)
+			fmt.Fprintf(out, "module %s@%s: no license detected, check + add manually\n", entry.Path, entry.Version)
+			report.AddFailure(entry, err.Error())
+			sbom.Add(entry, nil)
 			continue
 		default:
 			// Happy path: keep going.
@@ -111,77 +457,201 @@ func run(s checker.State, rootMod string) error {
 
 		mod := fmt.Sprintf("%s@%s", li.LibraryName, li.LibraryVersion)
 
-		if _, found := seen[mod]; found {
-			continue
-		}
-		seen[mod] = struct{}{}
-
-		fmt.Printf("module %s: %s (%s)\n", mod, li.LicenseName, li.LicenseType)
+		report.Modules = append(report.Modules, li)
+		sbom.Add(entry, &li)
 
-		_, err = licensestxt.Write([]byte(fmt.Sprintf("Library %s used under the %s License, reproduced below:\n\n", mod, li.LicenseName)))
-		if err != nil {
-			return fmt.Errorf("module %s: while writing to LICENSES.txt: %w", mod, err)
+		exempt := false
+		if policy != nil {
+			if v := policy.Evaluate(li, now); v != nil {
+				report.Violations = append(report.Violations, *v)
+				continue
+			}
+		} else {
+			var v *checker.PolicyViolation
+			exempt, v = checker.CustomPolicy(custom, li)
+			if v != nil {
+				report.Violations = append(report.Violations, *v)
+				continue
+			}
 		}
 
-		license, err := ioutil.ReadFile(li.LicenseFile)
-		if err != nil {
-			s.Log.Debugf("%s: go mod entry is %#v", mod, li)
-			return fmt.Errorf("module %s: while reading license file '%s': %w", mod, li.LicenseFile, err)
-		}
-		licensestxt.Write(license)
-		licensestxt.Write([]byte("\n==============================\n\n"))
-		switch li.LicenseType {
-		case "reciprocal":
-			dstPath := filepath.Join("thirdparty", li.LibraryName)
-			os.MkdirAll(dstPath, 0755)
-			err := dirutil.CopyDirectory(li.SourceDir, dstPath)
-			if err != nil {
-				return fmt.Errorf("while copying the source code for the dependency '%s' due to the reprocical license %s, copying '%s' into '%s': %w", mod, li.LicenseName, li.SourceDir, dstPath, err)
+		licenseType := li.LicenseType
+		if li.ManuallyAsserted {
+			licenseType += ", manually asserted"
+		}
+		if li.Replacement() != "" {
+			fmt.Fprintf(out, "module %s => %s: %s (%s)\n", mod, li.Replacement(), li.LicenseName, licenseType)
+		} else {
+			fmt.Fprintf(out, "module %s: %s (%s)\n", mod, li.LicenseName, licenseType)
+		}
+		if packages {
+			for _, m := range li.Licenses {
+				fmt.Fprintf(out, "  %s pulled in by %s\n", m.LicenseName, strings.Join(m.Packages, ", "))
 			}
-		case "restricted":
-			if !strings.HasPrefix(li.LicenseName, "LGPL") {
-				if viper.GetBool("force") {
-					s.Log.Infof("module %s: the license %s is restricted but is not LGPL, cannot continue. Run with --force to ignore.", mod, li.LicenseName)
-					continue
-				} else {
-					return fmt.Errorf("module %s: the license %s is restricted but is not LGPL, cannot continue. Run with --force to ignore.", mod, li.LicenseName)
-				}
+		}
+		if multi {
+			var needers []string
+			for _, root := range neededBy[key] {
+				needers = append(needers, root.key())
 			}
+			fmt.Fprintf(out, "  needed by %s\n", strings.Join(needers, ", "))
+		}
+
+		copySource := true
+		if li.LicenseType == "restricted" && policy == nil && !exempt && li.RestrictedNotLGPL() {
+			if viper.GetBool("force") {
+				owners[i].Log.Infof("module %s: the license %s is restricted but is not LGPL, cannot continue. Run with --force to ignore.", mod, li.LicenseName)
+				copySource = false
+			} else {
+				return fmt.Errorf("module %s: the license %s is restricted but is not LGPL, cannot continue. Run with --force to ignore.", mod, li.LicenseName)
+			}
+		}
 
-			dstPath := filepath.Join("thirdparty", li.LibraryName)
+		results[key] = distributed{li: li, copySource: copySource}
+		if err := merged.add(li, neededBy[key], copySource); err != nil {
+			return err
+		}
+	}
+
+	// An Apache-2.0 module must come with its NOTICE files, which a custom
+	// template may well leave out.
+	missing, err := merged.writeLicenses()
+	if err != nil {
+		return err
+	}
+	for _, n := range missing {
+		fmt.Fprintf(out, "module %s@%s: the NOTICE file '%s' is not reproduced in %s\n", n.LibraryName, n.LibraryVersion, n.NoticeFile, layout.licenses)
+		report.MissingNotices = append(report.MissingNotices, n)
+	}
 
-			os.MkdirAll(dstPath, 0755)
-			err := dirutil.CopyDirectory(li.SourceDir, dstPath)
+	if multi {
+		report.Roots = make(map[string][]string)
+		for r, root := range roots {
+			b, err := newBundle(names.relative().in(filepath.Join(outputDir, "roots", root.key())), checker.Attribution{Root: root.key(), Grouped: grouped}, tmpl, except)
 			if err != nil {
-				return fmt.Errorf("while copying the root's source code (%s) due to the restricted license %s of the dependency '%s': copying dir '%s' into '%s': %w", rootMod, li.LicenseName, mod, li.SourceDir, dstPath, err)
+				return err
 			}
+			defer b.Close()
 
-			// We need to copy the source code of the module given by the
-			// user, since this restricted dependency requires source code
-			// to be distributed.
-			rootModInfo, err := s.GoDownload(rootMod)
-			if err != nil {
-				return fmt.Errorf("while copying the root's source code (%s) due to the restricted license %s of the dependency '%s': while go listing '%s': %w", rootMod, li.LicenseName, mod, mod, err)
+			// With --packages, the modules that this root shares with
+			// others were classified with the packages of all of them, so
+			// they are classified again with the packages of this root.
+			var own []checker.GoModuleInfo
+			var states []*checker.State
+			for _, entry := range root.modules {
+				key := checker.ModuleVersion{Path: entry.Path, Version: entry.Version}.String()
+				if _, found := results[key]; found && packages && len(entry.Packages) != len(union[index[key]].Packages) {
+					own = append(own, entry)
+					states = append(states, &roots[r].state)
+				}
+			}
+			reclassified := make(map[string]checker.LicenseInfo)
+			for i, c := range classifyAll(own, states, jobs) {
+				if c.err == nil {
+					reclassified[checker.ModuleVersion{Path: own[i].Path, Version: own[i].Version}.String()] = c.li
+				}
 			}
 
-			if _, found := seen["LGPL"]; found {
-				continue
+			report.Roots[root.key()] = []string{}
+			for _, entry := range root.modules {
+				key := checker.ModuleVersion{Path: entry.Path, Version: entry.Version}.String()
+				if !entry.Main {
+					report.Roots[root.key()] = append(report.Roots[root.key()], key)
+				}
+				d, found := results[key]
+				if !found {
+					continue
+				}
+				if li, found := reclassified[key]; found {
+					d.li = li
+				}
+				if err := b.add(d.li, []rootModule{root}, d.copySource); err != nil {
+					return err
+				}
+			}
+			// The same template is used, so the missing NOTICE files
+			// are the ones already reported for the merged bundle.
+			if _, err := b.writeLicenses(); err != nil {
+				return err
 			}
-			seen["LGPL"] = struct{}{}
+		}
 
-			dstPath = filepath.Join("firstparty", rootModInfo.Path)
+		path := filepath.Join(outputDir, "roots.json")
+		mapping, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("creating %s: %w", path, err)
+		}
+		defer mapping.Close()
+		enc := json.NewEncoder(mapping)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report.Roots); err != nil {
+			return fmt.Errorf("while writing %s: %w", path, err)
+		}
+	}
 
-			err = os.MkdirAll(dstPath, 0755)
-			if err != nil {
-				return fmt.Errorf("mkdir -p %s: %w", dstPath, err)
-			}
+	switch format {
+	case "json":
+		if err := report.WriteJSON(os.Stdout); err != nil {
+			return fmt.Errorf("while writing the JSON report: %w", err)
+		}
+	case "spdx", "spdx-json", "cyclonedx", "cyclonedx-xml":
+		sbom.Graph, err = s.GoModGraph(roots[0].modules)
+		if err != nil {
+			return fmt.Errorf("while reading the module graph: %w", err)
+		}
+		switch format {
+		case "spdx":
+			err = sbom.WriteSPDXTagValue(os.Stdout)
+		case "spdx-json":
+			err = sbom.WriteSPDXJSON(os.Stdout)
+		case "cyclonedx":
+			err = sbom.WriteCycloneDXJSON(os.Stdout)
+		case "cyclonedx-xml":
+			err = sbom.WriteCycloneDXXML(os.Stdout)
+		}
+		if err != nil {
+			return fmt.Errorf("while writing the %s SBOM: %w", format, err)
+		}
+	}
 
-			err = dirutil.CopyDirectory(rootModInfo.Dir, dstPath)
-			if err != nil {
-				return fmt.Errorf("while copying the root's source code (%s) due to the restricted license %s of the dependency '%s': while copying dir '%s' into '%s': %w", rootMod, li.LicenseName, mod, li.SourceDir, dstPath, err)
-			}
+	if len(report.Violations) > 0 {
+		var summary strings.Builder
+		for _, v := range report.Violations {
+			summary.WriteString("\n  " + v.String())
 		}
+		source := viper.GetString("policy")
+		if source == "" {
+			source = viper.GetString("custom-licenses")
+		}
+		return fmt.Errorf("%d modules do not comply with the license policy '%s':%s", len(report.Violations), source, summary.String())
 	}
 
 	return nil
 }
+
+// mergePackages returns the union of the packages, sorted by import path.
+func mergePackages(a, b []checker.GoPackageInfo) []checker.GoPackageInfo {
+	seen := make(map[string]struct{})
+	var merged []checker.GoPackageInfo
+	for _, p := range append(append([]checker.GoPackageInfo{}, a...), b...) {
+		if _, found := seen[p.ImportPath]; found {
+			continue
+		}
+		seen[p.ImportPath] = struct{}{}
+		merged = append(merged, p)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ImportPath < merged[j].ImportPath })
+	return merged
+}
+
+func absPaths(paths ...string) ([]string, error) {
+	var abs []string
+	for _, path := range paths {
+		p, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("while resolving the absolute path of '%s': %w", path, err)
+		}
+		abs = append(abs, p)
+	}
+	return abs, nil
+}
@@ -1,5 +0,0 @@
-// +build tools
-
-package licenses
-
-// Placeholder, allows others to pull in the licenses.db file via go.mod.
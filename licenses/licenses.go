@@ -0,0 +1,12 @@
+// Package licenses holds the license corpus of the licenseclassifier. Each
+// file is named after the SPDX identifier of its license, and the license
+// headers end with ".header.txt".
+package licenses
+
+import "embed"
+
+// FS holds the license texts, which are embedded in the binary so that the
+// corpus is pinned and available without network.
+//
+//go:embed *.txt
+var FS embed.FS
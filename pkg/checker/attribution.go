@@ -0,0 +1,348 @@
+package checker
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Attribution is the data given to the attribution templates.
+type Attribution struct {
+	// Root is the root module, or the root modules separated by commas.
+	Root    string
+	Modules []AttributedModule
+
+	// When Grouped is true, the templates reproduce each license text once
+	// along with the modules that use it, as given by Groups.
+	Grouped bool
+	Groups  []LicenseGroup
+
+	// Copyrights holds the distinct copyright lines of all the modules.
+	Copyrights []string
+}
+
+// Complete sets the Copyrights and, when Grouped is true, the Groups from
+// the Modules.
+func (a *Attribution) Complete() {
+	if a.Grouped {
+		a.Group()
+	}
+
+	seen := make(map[string]struct{})
+	a.Copyrights = []string{}
+	for _, m := range a.Modules {
+		for _, line := range m.Copyrights {
+			if _, found := seen[line]; found {
+				continue
+			}
+			seen[line] = struct{}{}
+			a.Copyrights = append(a.Copyrights, line)
+		}
+	}
+	sort.Strings(a.Copyrights)
+}
+
+// AttributedModule is a module along with the texts of its licenses and
+// NOTICE files.
+type AttributedModule struct {
+	LicenseInfo
+	// Texts holds each distinct license text of the module.
+	Texts   []LicenseText
+	Notices []NoticeText
+}
+
+type NoticeText struct {
+	// File is relative to the module's directory.
+	File string
+	Text string
+}
+
+type LicenseText struct {
+	LicenseName string
+	// File is relative to the module's directory.
+	File string
+	Text string
+}
+
+// NewAttributedModule reads the license texts of the module. The Licenses
+// of the module are never empty.
+func NewAttributedModule(li LicenseInfo) (AttributedModule, error) {
+	if len(li.Licenses) == 0 {
+		li.Licenses = []LicenseMatch{{LicenseName: li.LicenseName, LicenseFile: li.LicenseFile}}
+	}
+
+	m := AttributedModule{LicenseInfo: li}
+	written := make(map[string]struct{})
+	for _, match := range li.Licenses {
+		text, err := ioutil.ReadFile(match.LicenseFile)
+		if err != nil {
+			return AttributedModule{}, fmt.Errorf("while reading license file '%s': %w", match.LicenseFile, err)
+		}
+		if _, found := written[string(text)]; found {
+			continue
+		}
+		written[string(text)] = struct{}{}
+
+		m.Texts = append(m.Texts, LicenseText{
+			LicenseName: match.LicenseName,
+			File:        strings.TrimPrefix(match.LicenseFile, li.SourceDir+"/"),
+			Text:        string(text),
+		})
+	}
+
+	for _, f := range li.NoticeFiles {
+		text, err := ioutil.ReadFile(f)
+		if err != nil {
+			return AttributedModule{}, fmt.Errorf("while reading NOTICE file '%s': %w", f, err)
+		}
+		m.Notices = append(m.Notices, NoticeText{
+			File: strings.TrimPrefix(f, li.SourceDir+"/"),
+			Text: string(text),
+		})
+	}
+	return m, nil
+}
+
+// LicenseGroup is a license text shared by several modules. Two texts that
+// only differ in whitespace are the same, but texts that differ in their
+// copyright lines are not.
+type LicenseGroup struct {
+	LicenseNames []string
+	// Libraries are of the form "path@version", followed by the
+	// replacement and whether the license was manually asserted.
+	Libraries []string
+	Text      string
+}
+
+// Group sets the Groups from the Modules. The groups are in the order of
+// the first module that uses them.
+func (a *Attribution) Group() {
+	a.Groups = []LicenseGroup{}
+	index := make(map[string]int)
+	for _, m := range a.Modules {
+		library := fmt.Sprintf("%s@%s", m.LibraryName, m.LibraryVersion)
+		if m.Replacement() != "" {
+			library += fmt.Sprintf(" (replaced by %s)", m.Replacement())
+		}
+		if m.ManuallyAsserted {
+			library += " (manually asserted)"
+		}
+
+		for _, t := range m.Texts {
+			normalized := normalizeLicenseText(t.Text)
+			i, found := index[normalized]
+			if !found {
+				i = len(a.Groups)
+				index[normalized] = i
+				a.Groups = append(a.Groups, LicenseGroup{Text: t.Text})
+			}
+			g := &a.Groups[i]
+			if !contains(g.LicenseNames, t.LicenseName) {
+				g.LicenseNames = append(g.LicenseNames, t.LicenseName)
+			}
+			if !contains(g.Libraries, library) {
+				g.Libraries = append(g.Libraries, library)
+			}
+		}
+	}
+}
+
+// normalizeLicenseText collapses the whitespace, so that the line endings,
+// the indentation and the wrapping of the paragraphs don't matter.
+func normalizeLicenseText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// AttributionTemplate is either a text/template or an html/template.
+type AttributionTemplate interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// The built-in templates.
+const (
+	TemplateText     = "text"
+	TemplateMarkdown = "markdown"
+	TemplateHTML     = "html"
+)
+
+// attributionFuncs are the functions available in the templates in
+// addition to the built-in ones.
+var attributionFuncs = map[string]interface{}{
+	"join": strings.Join,
+}
+
+// LoadAttributionTemplate returns one of the built-in templates, or parses
+// the template file at the given path. A file with the .html or .htm
+// extension is parsed as an html/template, so that the license texts are
+// escaped, and any other file as a text/template.
+func LoadAttributionTemplate(nameOrPath string) (AttributionTemplate, error) {
+	switch nameOrPath {
+	case TemplateText:
+		return template.Must(template.New(TemplateText).Funcs(attributionFuncs).Parse(textAttribution)), nil
+	case TemplateMarkdown:
+		return template.Must(template.New(TemplateMarkdown).Funcs(attributionFuncs).Parse(markdownAttribution)), nil
+	case TemplateHTML:
+		return htmltemplate.Must(htmltemplate.New(TemplateHTML).Funcs(attributionFuncs).Parse(htmlAttribution)), nil
+	}
+
+	content, err := ioutil.ReadFile(nameOrPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading the template file '%s': %w", nameOrPath, err)
+	}
+	name := filepath.Base(nameOrPath)
+	switch strings.ToLower(filepath.Ext(nameOrPath)) {
+	case ".html", ".htm":
+		tmpl, err := htmltemplate.New(name).Funcs(attributionFuncs).Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("parsing the template file '%s': %w", nameOrPath, err)
+		}
+		return tmpl, nil
+	}
+	tmpl, err := template.New(name).Funcs(attributionFuncs).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("parsing the template file '%s': %w", nameOrPath, err)
+	}
+	return tmpl, nil
+}
+
+// When a module has several licenses, each text is preceded by its
+// license and file.
+const textAttribution = `{{if .Grouped}}{{range .Groups -}}
+Libraries used under the {{join .LicenseNames " / "}} License, reproduced below:
+
+{{range .Libraries}}  {{.}}
+{{end}}
+{{.Text}}
+==============================
+
+{{end}}{{range .Modules}}{{$module := .}}{{range .Notices -}}
+NOTICE of {{$module.LibraryName}}@{{$module.LibraryVersion}} ({{.File}}):
+
+{{.Text}}
+==============================
+
+{{end}}{{end}}{{else}}{{range .Modules}}{{$several := gt (len .Licenses) 1 -}}
+Library {{.LibraryName}}@{{.LibraryVersion}}{{with .Replacement}} (replaced by {{.}}){{end}} used under the {{.LicenseName}} License{{if .ManuallyAsserted}} (manually asserted){{end}}, reproduced below:
+
+{{range .Texts}}{{if $several}}{{.LicenseName}} ({{.File}}):
+
+{{end}}{{.Text}}
+{{end}}{{range .Notices}}NOTICE ({{.File}}):
+
+{{.Text}}
+{{end}}==============================
+
+{{end}}{{end}}{{if .Copyrights}}Copyright notices of the libraries above:
+
+{{range .Copyrights}}{{.}}
+{{end}}{{end}}`
+
+const markdownAttribution = `# Third-party licenses
+
+{{.Root}} uses the following libraries.
+{{if .Grouped}}{{range .Groups}}
+## {{join .LicenseNames " / "}}
+
+Used by:
+{{range .Libraries}}
+- {{.}}{{end}}
+
+` + "```" + `
+{{.Text}}
+` + "```" + `
+{{end}}{{range .Modules}}{{$module := .}}{{range .Notices}}
+## NOTICE of {{$module.LibraryName}}{{with $module.LibraryVersion}} {{.}}{{end}} ({{.File}})
+
+` + "```" + `
+{{.Text}}
+` + "```" + `
+{{end}}{{end}}{{else}}{{range .Modules}}{{$several := gt (len .Licenses) 1}}
+## {{.LibraryName}}{{with .LibraryVersion}} {{.}}{{end}}
+
+License: {{.LicenseName}}{{if .ManuallyAsserted}} (manually asserted){{end}}
+{{- with .Replacement}}
+
+Replaced by {{.}}{{end}}
+{{range .Texts}}{{if $several}}
+### {{.LicenseName}} ({{.File}})
+{{end}}
+` + "```" + `
+{{.Text}}
+` + "```" + `
+{{end}}{{range .Notices}}
+### NOTICE ({{.File}})
+
+` + "```" + `
+{{.Text}}
+` + "```" + `
+{{end}}{{end}}{{end}}{{if .Copyrights}}
+## Copyright notices
+{{range .Copyrights}}
+    {{.}}{{end}}
+{{end}}`
+
+const htmlAttribution = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Third-party licenses</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre { white-space: pre-wrap; background: #f6f8fa; padding: 1em; }
+</style>
+</head>
+<body>
+<h1>Third-party licenses</h1>
+<p>{{.Root}} uses the following libraries.</p>
+{{- if .Grouped}}
+{{range .Groups}}
+<h2>{{join .LicenseNames " / "}}</h2>
+<p>Used by:</p>
+<ul>
+{{- range .Libraries}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+<pre>{{.Text}}</pre>
+{{end}}
+{{- range .Modules}}{{$module := .}}{{range .Notices}}
+<h2>NOTICE of {{$module.LibraryName}}{{with $module.LibraryVersion}} {{.}}{{end}} ({{.File}})</h2>
+<pre>{{.Text}}</pre>
+{{- end}}{{end}}
+{{- else}}
+<ul>
+{{- range $i, $m := .Modules}}
+<li><a href="#module-{{$i}}">{{.LibraryName}}{{with .LibraryVersion}} {{.}}{{end}}</a>: {{.LicenseName}}</li>
+{{- end}}
+</ul>
+{{range $i, $m := .Modules}}{{$several := gt (len .Licenses) 1}}
+<h2 id="module-{{$i}}">{{.LibraryName}}{{with .LibraryVersion}} {{.}}{{end}}</h2>
+<p>License: {{.LicenseName}}{{if .ManuallyAsserted}} (manually asserted){{end}}{{with .Replacement}}<br>Replaced by {{.}}{{end}}</p>
+{{- range .Texts}}
+{{- if $several}}
+<h3>{{.LicenseName}} ({{.File}})</h3>
+{{- end}}
+<pre>{{.Text}}</pre>
+{{- end}}
+{{- range .Notices}}
+<h3>NOTICE ({{.File}})</h3>
+<pre>{{.Text}}</pre>
+{{- end}}
+{{end}}
+{{- end}}
+{{- if .Copyrights}}
+<h2>Copyright notices</h2>
+<pre>
+{{- range .Copyrights}}
+{{.}}
+{{- end}}
+</pre>
+{{- end}}
+</body>
+</html>
+`
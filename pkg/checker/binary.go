@@ -0,0 +1,132 @@
+package checker
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// InitBinary prepares the state for analysing a compiled Go binary instead
+// of a root module. The build info embedded in the binary gives the exact
+// list of modules that were linked in along with their versions and sums.
+// The returned modules are downloaded into the module cache. The main
+// module is only downloaded when the binary was built from a tagged
+// version, e.g. with "go install example.com/cmd@v1.0.0".
+func (s *State) InitBinary(path string) ([]GoModuleInfo, error) {
+	if err := s.setup(); err != nil {
+		return nil, err
+	}
+
+	workingDir, err := newTempDir()
+	if err != nil {
+		return nil, fmt.Errorf("creating temp working dir: %w", err)
+	}
+	s.workingDir = workingDir
+	s.fromBinary = true
+
+	bi, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("while reading the build info of the binary '%s': %w", path, err)
+	}
+	s.Log.Infof("binary %s was built with %s from the main module %s@%s", path, bi.GoVersion, bi.Main.Path, bi.Main.Version)
+
+	modules, err := s.download(ModulesFromBuildInfo(bi))
+	if err != nil {
+		return nil, err
+	}
+	s.root = modules[0]
+	s.graph = make(map[string][]string)
+	addBinaryGraph(s.graph, GoModuleInfo{}, modules[0], modules[1:])
+
+	return modules, nil
+}
+
+// ModulesFromBuildInfo returns the main module followed by every module
+// linked into the binary, sorted by path.
+func ModulesFromBuildInfo(bi *debug.BuildInfo) []GoModuleInfo {
+	modules := []GoModuleInfo{{
+		Path:    bi.Main.Path,
+		Version: bi.Main.Version,
+		Sum:     bi.Main.Sum,
+		Main:    true,
+	}}
+	// A binary built from a local checkout has the version "(devel)".
+	if !strings.HasPrefix(bi.Main.Version, "v") {
+		modules[0].Version = ""
+	}
+
+	var deps []GoModuleInfo
+	for _, dep := range bi.Deps {
+		m := GoModuleInfo{Path: dep.Path, Version: dep.Version, Sum: dep.Sum}
+		if dep.Replace != nil {
+			m.Replace = &GoModuleInfo{Path: dep.Replace.Path, Version: dep.Replace.Version, Sum: dep.Replace.Sum}
+		}
+		deps = append(deps, m)
+	}
+	sort.Slice(deps, func(i, j int) bool { return deps[i].Path < deps[j].Path })
+
+	return append(modules, deps...)
+}
+
+// download sets the Dir of each module, or of its replacement, by
+// downloading it. The modules that cannot be downloaded, such as the local
+// replacements and the main module when it has no version, are left
+// without a Dir. The sums of the downloaded modules must match the sums
+// recorded in the binary. With --offline, the modules must all be in the
+// module cache.
+func (s *State) download(modules []GoModuleInfo) ([]GoModuleInfo, error) {
+	var args []string
+	for _, m := range modules {
+		src := source(m)
+		if src.Version == "" {
+			continue
+		}
+		args = append(args, src.Path+"@"+src.Version)
+	}
+	if len(args) == 0 {
+		return modules, nil
+	}
+
+	s.Log.Infof("downloading the %d modules found in the build info", len(args))
+	downloaded, err := s.GoDownloadAll(args...)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]GoModuleInfo)
+	for _, d := range downloaded {
+		byKey[d.Path+"@"+d.Version] = d
+	}
+
+	var mismatches, missing []string
+	for i, m := range modules {
+		src := source(m)
+		d, found := byKey[src.Path+"@"+src.Version]
+		switch {
+		case src.Version == "":
+			continue
+		case !found || d.Error != "":
+			s.Log.Infof("module %s@%s: could not be downloaded: %s", src.Path, src.Version, d.Error)
+			missing = append(missing, fmt.Sprintf("%s@%s: %s", src.Path, src.Version, strings.TrimSpace(d.Error)))
+			continue
+		case src.Sum != "" && d.Sum != "" && src.Sum != d.Sum:
+			mismatches = append(mismatches, fmt.Sprintf("%s@%s: the binary has %s but the download has %s", src.Path, src.Version, src.Sum, d.Sum))
+			continue
+		}
+		modules[i].Dir = d.Dir
+		if m.Replace != nil {
+			modules[i].Replace.Dir = d.Dir
+		}
+	}
+	if len(mismatches) > 0 {
+		return nil, fmt.Errorf("the sums of the following modules do not match the sums recorded in the binary:\n  %s", strings.Join(mismatches, "\n  "))
+	}
+	if s.offline {
+		if err := missingModulesError(missing); err != nil {
+			return nil, err
+		}
+	}
+
+	return modules, nil
+}
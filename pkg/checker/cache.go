@@ -0,0 +1,158 @@
+package checker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// detectorVersions is part of the cache key so that the cached results are
+// discarded when the detectors or the content of LicenseInfo change. It
+// must be bumped along with the detectors in go.mod. The license corpus is
+// part of the key on its own.
+const detectorVersions = "go-license-detector/v4@v4.1.1 licenseclassifier/v2@v2.0.0-alpha.1 format@1"
+
+// Cache stores the classification results on disk, so that a module is
+// only classified again when its content or the detectors change. Each
+// result is a JSON-encoded LicenseInfo.
+type Cache struct {
+	dir string
+}
+
+// DefaultCacheDir returns the go-providence-checker directory under the
+// user's cache directory, such as ~/.cache on Linux.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("while finding the user's cache directory: %w", err)
+	}
+	return filepath.Join(dir, "go-providence-checker"), nil
+}
+
+func OpenCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating the cache directory '%s': %w", dir, err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// cacheKey returns an empty key when the module can't be cached, i.e.,
+// when its content has no checksum such as for the local replacements. The
+// packages are part of the key since they change which license files
+// govern the module.
+func cacheKey(info GoModuleInfo, threshold float64, corpus string) string {
+	src := source(info)
+	if src.Sum == "" {
+		return ""
+	}
+
+	var pkgs []string
+	for _, p := range info.Packages {
+		pkgs = append(pkgs, p.ImportPath)
+	}
+	// The vendored modules nested in this one are left out of it.
+	var nested []string
+	for dir := range info.VendorDirs {
+		if strings.HasPrefix(dir, info.Dir+string(filepath.Separator)) {
+			nested = append(nested, dir)
+		}
+	}
+	sort.Strings(nested)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s@%s\n%s@%s %s\n%s\n%g\n%s\n", info.Path, info.Version, src.Path, src.Version, src.Sum, info.Dir, threshold, detectorVersions)
+	fmt.Fprintf(h, "%s\n%s\n%s\n", strings.Join(pkgs, " "), corpus, strings.Join(nested, " "))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// Get returns the cached result. A result whose license files have since
+// been removed, such as after 'go clean -modcache', is ignored.
+func (c *Cache) Get(key string) (LicenseInfo, bool) {
+	content, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return LicenseInfo{}, false
+	}
+	var li LicenseInfo
+	if err := json.Unmarshal(content, &li); err != nil {
+		return LicenseInfo{}, false
+	}
+	for _, m := range li.Licenses {
+		if _, err := os.Stat(m.LicenseFile); err != nil {
+			return LicenseInfo{}, false
+		}
+	}
+
+	// The modification time tells Prune when the result was last used.
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	return li, true
+}
+
+func (c *Cache) Put(key string, li LicenseInfo) error {
+	content, err := json.Marshal(li)
+	if err != nil {
+		return err
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// The result is written to a temporary file first so that concurrent
+	// runs never read a partial result.
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Prune removes the results that were not used for longer than maxAge. All
+// the results are removed when maxAge is 0. It returns the number of
+// results removed.
+func (c *Cache) Prune(maxAge time.Duration) (int, error) {
+	removed := 0
+	cutoff := time.Now().Add(-maxAge)
+	err := filepath.Walk(c.dir, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fileInfo.IsDir() {
+			return nil
+		}
+		if maxAge > 0 && fileInfo.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if strings.HasSuffix(path, ".json") {
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("while pruning the cache directory '%s': %w", c.dir, err)
+	}
+	return removed, nil
+}
@@ -0,0 +1,121 @@
+package checker
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// copyrightRegex matches the lines that start with a copyright statement,
+// such as "Copyright (c) 2016 Alessio Treglia", "Copyright The Go Authors"
+// or "© 2019 Jetstack". The statement must go on with a year or a
+// capitalized name so that the prose such as "copyright, patent, trademark"
+// isn't matched. The comment markers are stripped beforehand.
+var copyrightRegex = regexp.MustCompile(`^(?i:copyright)(\s*(?i:\(c\))|\s*©)?\s+(\d{4}|[A-Z])|^(©|\([cC]\))\s*\d{4}`)
+
+// copyrightPlaceholderRegex matches the lines that talk about copyright
+// without being a statement, such as "The above copyright notice..." or the
+// "Copyright [yyyy] [name of copyright owner]" of the Apache-2.0 appendix.
+var copyrightPlaceholderRegex = regexp.MustCompile(`(?i)copyright (notice|holder|owner|license|law|and license|statement)s?\b|\[yyyy\]|\{yyyy\}|<year>|\[year\]|\{year\}|\[name of`)
+
+// copyrights returns the copyright lines found in the license files and in
+// the header of the Go source files, i.e., the comments before the package
+// clause, sorted and without duplicates. When the packages of the module
+// are known, only the files of these packages are read. The files that
+// can't be read are skipped.
+func copyrights(info GoModuleInfo, licenseFiles []string) []string {
+	found := make(map[string]struct{})
+	for _, f := range licenseFiles {
+		for _, line := range copyrightLines(f, false) {
+			found[line] = struct{}{}
+		}
+	}
+	for _, f := range goSourceFiles(info) {
+		for _, line := range copyrightLines(f, true) {
+			found[line] = struct{}{}
+		}
+	}
+
+	lines := []string{}
+	for line := range found {
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// copyrightLines returns the copyright lines of the file. When header is
+// true, the file is only read up to the package clause.
+func copyrightLines(path string, header bool) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if header && strings.HasPrefix(line, "package ") {
+			break
+		}
+		line = strings.TrimLeft(line, "/*#-;! \t")
+		line = strings.TrimSpace(strings.TrimSuffix(line, "*/"))
+		line = strings.Join(strings.Fields(line), " ")
+		if copyrightRegex.MatchString(line) && !copyrightPlaceholderRegex.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// goSourceFiles returns the non-test Go files of the packages of the module,
+// or of the whole module when its packages are unknown. The directories
+// skipped by the go command, such as testdata, and the nested modules are
+// left out.
+func goSourceFiles(info GoModuleInfo) []string {
+	isSource := func(name string) bool {
+		return strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go")
+	}
+
+	var files []string
+	if len(info.Packages) > 0 {
+		for _, p := range info.Packages {
+			entries, err := ioutil.ReadDir(p.Dir)
+			if err != nil {
+				continue
+			}
+			for _, e := range entries {
+				if !e.IsDir() && isSource(e.Name()) {
+					files = append(files, filepath.Join(p.Dir, e.Name()))
+				}
+			}
+		}
+		return files
+	}
+
+	filepath.Walk(info.Dir, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if fileInfo.IsDir() {
+			if path == info.Dir {
+				return nil
+			}
+			if strings.HasPrefix(fileInfo.Name(), ".") || skipDir(path, info.VendorDirs) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isSource(fileInfo.Name()) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
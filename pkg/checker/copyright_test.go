@@ -0,0 +1,97 @@
+package checker
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCopyrightRegexes(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{line: "Copyright (c) 2016 Alessio Treglia", want: true},
+		{line: "Copyright (C) 2016 Alessio Treglia", want: true},
+		{line: "COPYRIGHT 2016 Alessio Treglia", want: true},
+		{line: "Copyright 2009 The Go Authors. All rights reserved.", want: true},
+		{line: "Copyright The Go Authors", want: true},
+		{line: "Copyright © 2019 Jetstack", want: true},
+		{line: "© 2019 Jetstack", want: true},
+		{line: "(c) 2019 Jetstack", want: true},
+
+		// Prose and placeholders.
+		{line: "copyright, patent, trademark and attribution notices", want: false},
+		{line: "Copyright law applies", want: false},
+		{line: "The above copyright notice and this permission notice shall be included", want: false},
+		{line: "Copyright [yyyy] [name of copyright owner]", want: false},
+		{line: "Copyright {yyyy} {name of copyright owner}", want: false},
+		{line: "Copyright <year> <copyright holders>", want: false},
+		{line: "Copyright Holders may redistribute", want: false},
+		{line: "the Copyright 2019 in the middle", want: false},
+		{line: "(c) the authors", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := copyrightRegex.MatchString(tt.line) && !copyrightPlaceholderRegex.MatchString(tt.line)
+			if got != tt.want {
+				t.Errorf("matching %q = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyrightLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		header  bool
+		want    []string
+	}{
+		{
+			name: "license file",
+			content: `The MIT License (MIT)
+
+Copyright (c) 2016   Alessio Treglia
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+`,
+			want: []string{"Copyright (c) 2016 Alessio Treglia"},
+		},
+		{
+			name: "comment markers are stripped",
+			content: `// Copyright 2009 The Go Authors.
+/* Copyright 2010 Jetstack */
+# Copyright 2011 Someone
+ * Copyright 2012 Someone Else
+`,
+			want: []string{"Copyright 2009 The Go Authors.", "Copyright 2010 Jetstack", "Copyright 2011 Someone", "Copyright 2012 Someone Else"},
+		},
+		{
+			name: "only the header of Go files",
+			content: `// Copyright 2009 The Go Authors.
+
+package foo
+
+// Copyright 2010 Not A Header
+`,
+			header: true,
+			want:   []string{"Copyright 2009 The Go Authors."},
+		},
+		{
+			name:    "no copyright",
+			content: "package foo\n",
+			header:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			writeTestFile(t, path, tt.content)
+			if got := copyrightLines(path, tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("copyrightLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
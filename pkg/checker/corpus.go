@@ -0,0 +1,125 @@
+package checker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	classifier "github.com/google/licenseclassifier/v2"
+	"github.com/jakexks/go-providence-checker/licenses"
+)
+
+// newClassifier loads the license corpus embedded from the licenses
+// directory, along with the license texts found in extraLicensesDir and the
+// custom licenses.
+func (s *State) newClassifier() (*classifier.Classifier, error) {
+	texts, err := corpus(s.extraLicensesDir, s.custom)
+	if err != nil {
+		return nil, err
+	}
+	c := classifier.NewClassifier(0.2)
+	for _, t := range texts {
+		c.AddContent(t.name, []byte(trimLicenseText(t.text)))
+	}
+	return c, nil
+}
+
+type corpusText struct {
+	name, text string
+}
+
+// corpus returns the texts of the embedded corpus followed by the texts of
+// the extra directory, if any, and by the custom licenses. A text is named
+// after its file without the ".txt" extension, such as "MIT" or
+// "Apache-2.0.header", or after the id of the custom license.
+func corpus(extraDir string, custom []CustomLicense) ([]corpusText, error) {
+	var texts []corpusText
+	err := fs.WalkDir(licenses.FS, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".txt") {
+			return nil
+		}
+		content, err := fs.ReadFile(licenses.FS, path)
+		if err != nil {
+			return err
+		}
+		texts = append(texts, corpusText{name: strings.TrimSuffix(d.Name(), ".txt"), text: string(content)})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while reading the embedded license corpus: %w", err)
+	}
+
+	if extraDir != "" {
+		entries, err := ioutil.ReadDir(extraDir)
+		if err != nil {
+			return nil, fmt.Errorf("while reading the extra license directory '%s': %w", extraDir, err)
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".txt") {
+				continue
+			}
+			content, err := ioutil.ReadFile(filepath.Join(extraDir, e.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("while reading the extra license file '%s': %w", filepath.Join(extraDir, e.Name()), err)
+			}
+			texts = append(texts, corpusText{name: strings.TrimSuffix(e.Name(), ".txt"), text: string(content)})
+		}
+	}
+
+	for _, l := range custom {
+		texts = append(texts, corpusText{name: l.ID, text: l.Text})
+	}
+	return texts, nil
+}
+
+// corpusDigest identifies the content of the corpus, so that the cached
+// results are discarded when the embedded, extra or custom texts change.
+// The types of the custom licenses are also part of the results.
+func corpusDigest(extraDir string, custom []CustomLicense) (string, error) {
+	texts, err := corpus(extraDir, custom)
+	if err != nil {
+		return "", err
+	}
+	sort.SliceStable(texts, func(i, j int) bool { return texts[i].name < texts[j].name })
+
+	h := sha256.New()
+	for _, t := range texts {
+		fmt.Fprintf(h, "%s\n%d\n%s", t.name, len(t.text), t.text)
+	}
+	for _, l := range custom {
+		fmt.Fprintf(h, "%s %s\n", l.ID, l.Type)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// trimLicenseText removes what comes after the end of the terms, such as
+// the "How to apply" appendix of the Apache-2.0 and GPL licenses, like the
+// licenseclassifier does when loading a directory.
+func trimLicenseText(text string) string {
+	if i := strings.LastIndex(text, "END OF TERMS AND CONDITIONS"); i != -1 {
+		return text[:i]
+	}
+	return text
+}
+
+// checkExtraLicensesDir fails early when the extra license directory can't
+// be used, instead of when the classifier is first needed.
+func checkExtraLicensesDir(dir string) error {
+	fileInfo, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("while reading the extra license directory: %w", err)
+	}
+	if !fileInfo.IsDir() {
+		return fmt.Errorf("the extra license path '%s' is not a directory", dir)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package checker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// CustomLicense is a license that the detectors don't know, such as an
+// internal or a vendor license. The custom licenses file looks like:
+//
+//	licenses:
+//	  - id: LicenseRef-ACME-1.0
+//	    type: notice
+//	    policy: allow
+//	    file: licenses/acme-1.0.txt
+//
+// The id is reported as the license name, and should start with
+// "LicenseRef-" for the SPDX outputs to be valid. The type is one of the
+// license types such as notice or restricted. The optional policy is
+// either allow, deny or review. The file is relative to the custom
+// licenses file.
+type CustomLicense struct {
+	ID     string `mapstructure:"id"`
+	Type   string `mapstructure:"type"`
+	Policy string `mapstructure:"policy"`
+	File   string `mapstructure:"file"`
+
+	// Text is the content of the file.
+	Text string `mapstructure:"-"`
+}
+
+// The license types known to the licenseclassifier.
+var licenseTypes = []string{"restricted", "reciprocal", "notice", "permissive", "unencumbered", "by_exception_only", "forbidden"}
+
+// The policies that a custom license may have.
+const (
+	CustomPolicyAllow  = "allow"
+	CustomPolicyDeny   = "deny"
+	CustomPolicyReview = "review"
+)
+
+// LoadCustomLicenses reads the custom licenses file and the license texts.
+// The format is guessed from the file extension.
+func LoadCustomLicenses(path string) ([]CustomLicense, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading the custom licenses file '%s': %w", path, err)
+	}
+
+	var file struct {
+		Licenses []CustomLicense `mapstructure:"licenses"`
+	}
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, fmt.Errorf("parsing the custom licenses file '%s': %w", path, err)
+	}
+
+	seen := make(map[string]struct{})
+	for i, l := range file.Licenses {
+		switch {
+		case l.ID == "":
+			return nil, fmt.Errorf("custom licenses file '%s': a license is missing the 'id' field", path)
+		case strings.ContainsAny(l.ID, "_ ") || strings.Contains(l.ID, ".header"):
+			// The licenseclassifier cuts the names at the first underscore
+			// and at ".header".
+			return nil, fmt.Errorf("custom licenses file '%s': the id '%s' must not contain spaces, underscores or '.header'", path, l.ID)
+		case !contains(licenseTypes, l.Type):
+			return nil, fmt.Errorf("custom licenses file '%s': the license %s has the type '%s', expected one of %s", path, l.ID, l.Type, strings.Join(licenseTypes, ", "))
+		case l.Policy != "" && l.Policy != CustomPolicyAllow && l.Policy != CustomPolicyDeny && l.Policy != CustomPolicyReview:
+			return nil, fmt.Errorf("custom licenses file '%s': the license %s has the policy '%s', expected allow, deny or review", path, l.ID, l.Policy)
+		case l.File == "":
+			return nil, fmt.Errorf("custom licenses file '%s': the license %s is missing the 'file' field", path, l.ID)
+		}
+		if _, found := seen[l.ID]; found {
+			return nil, fmt.Errorf("custom licenses file '%s': the license %s is given twice", path, l.ID)
+		}
+		seen[l.ID] = struct{}{}
+
+		if !filepath.IsAbs(l.File) {
+			l.File = filepath.Join(filepath.Dir(path), l.File)
+		}
+		text, err := ioutil.ReadFile(l.File)
+		if err != nil {
+			return nil, fmt.Errorf("custom licenses file '%s': while reading the text of the license %s: %w", path, l.ID, err)
+		}
+		if normalizeLicenseText(string(text)) == "" {
+			return nil, fmt.Errorf("custom licenses file '%s': the text of the license %s in '%s' is empty", path, l.ID, l.File)
+		}
+		l.Text = string(text)
+		file.Licenses[i] = l
+	}
+
+	return file.Licenses, nil
+}
+
+func findCustomLicense(custom []CustomLicense, id string) (CustomLicense, bool) {
+	for _, l := range custom {
+		if l.ID == id {
+			return l, true
+		}
+	}
+	return CustomLicense{}, false
+}
+
+// customCandidates returns the license files of the module, at its root or
+// in the given subdirectories, that contain the text of a custom license.
+// The whitespace doesn't matter since go-license-detector doesn't know the
+// custom licenses and can't be used.
+func customCandidates(custom []CustomLicense, root string, subdirs []string) []candidate {
+	if len(custom) == 0 {
+		return nil
+	}
+
+	var candidates []candidate
+	for _, dir := range append([]string{root}, subdirs...) {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || !subdirLicenseRegex.MatchString(e.Name()) {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			text := normalizeLicenseText(string(content))
+			for _, l := range custom {
+				if strings.Contains(text, normalizeLicenseText(l.Text)) {
+					candidates = append(candidates, candidate{license: l.ID, confidence: 1, path: path})
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+// withCustomCandidates replaces the candidates of go-license-detector that
+// were found in the files of the custom licenses, since they are only
+// approximations of the custom license.
+func withCustomCandidates(candidates, custom []candidate) []candidate {
+	if len(custom) == 0 {
+		return candidates
+	}
+	customFiles := make(map[string]struct{})
+	for _, c := range custom {
+		customFiles[c.path] = struct{}{}
+	}
+	var kept []candidate
+	for _, c := range candidates {
+		if _, found := customFiles[c.path]; !found {
+			kept = append(kept, c)
+		}
+	}
+	return append(kept, custom...)
+}
+
+// applyCustomTypes sets the type of the custom licenses found in the module
+// since the licenseclassifier doesn't know them.
+func applyCustomTypes(li *LicenseInfo, custom []CustomLicense) {
+	changed := false
+	for i, m := range li.Licenses {
+		if l, found := findCustomLicense(custom, m.LicenseName); found {
+			li.Licenses[i].LicenseType = l.Type
+			changed = true
+		}
+	}
+	if changed {
+		li.LicenseType = expressionType(li.Licenses)
+	}
+}
+
+// AddCustomLicenses adds the custom licenses that have a policy to the
+// lists of licenses of the policy. The lists of the policy file take
+// precedence.
+func (p *Policy) AddCustomLicenses(custom []CustomLicense) {
+	for _, l := range custom {
+		if contains(p.Allow.Licenses, l.ID) || contains(p.Deny.Licenses, l.ID) || contains(p.Review.Licenses, l.ID) {
+			continue
+		}
+		switch l.Policy {
+		case CustomPolicyAllow:
+			p.Allow.Licenses = append(p.Allow.Licenses, l.ID)
+		case CustomPolicyDeny:
+			p.Deny.Licenses = append(p.Deny.Licenses, l.ID)
+		case CustomPolicyReview:
+			p.Review.Licenses = append(p.Review.Licenses, l.ID)
+		}
+	}
+}
+
+// CustomPolicy evaluates the custom licenses of the module when no policy
+// file is given. A violation is returned when one of them is to be denied
+// or reviewed. Otherwise, exempt is true when the restricted licenses of
+// the module are all custom licenses that are allowed, in which case the
+// built-in check of the restricted licenses doesn't apply.
+func CustomPolicy(custom []CustomLicense, li LicenseInfo) (exempt bool, v *PolicyViolation) {
+	p := &Policy{}
+	p.AddCustomLicenses(custom)
+
+	restricted, allowed := 0, 0
+	for _, m := range li.Licenses {
+		if m.LicenseType == "restricted" {
+			restricted++
+		}
+		l, found := findCustomLicense(custom, m.LicenseName)
+		if !found || l.Policy == "" {
+			continue
+		}
+		decision, reason := p.decideLicense(l.ID, l.Type)
+		if decision == PolicyAllowed {
+			if m.LicenseType == "restricted" {
+				allowed++
+			}
+			continue
+		}
+		return false, &PolicyViolation{
+			LibraryName:    li.LibraryName,
+			LibraryVersion: li.LibraryVersion,
+			LicenseName:    li.LicenseName,
+			LicenseType:    li.LicenseType,
+			Decision:       decision,
+			Reason:         reason + " of the custom licenses file",
+		}
+	}
+	return restricted > 0 && restricted == allowed, nil
+}
@@ -0,0 +1,319 @@
+package checker
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// The CycloneDX 1.5 BOM, as described in
+// https://cyclonedx.org/docs/1.5/json/. The same structs are used for both
+// the JSON and the XML encodings.
+type cdxBOM struct {
+	XMLName      xml.Name        `json:"-" xml:"bom"`
+	XMLNS        string          `json:"-" xml:"xmlns,attr"`
+	BOMFormat    string          `json:"bomFormat" xml:"-"`
+	SpecVersion  string          `json:"specVersion" xml:"-"`
+	SerialNumber string          `json:"serialNumber" xml:"serialNumber,attr"`
+	Version      int             `json:"version" xml:"version,attr"`
+	Metadata     cdxMetadata     `json:"metadata" xml:"metadata"`
+	Components   []cdxComponent  `json:"components" xml:"components>component"`
+	Dependencies []cdxDependency `json:"dependencies" xml:"dependencies>dependency"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp" xml:"timestamp"`
+	Tools     cdxTools     `json:"tools" xml:"tools"`
+	Component cdxComponent `json:"component" xml:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components" xml:"components>component"`
+}
+
+type cdxComponent struct {
+	Type               string                 `json:"type"`
+	BOMRef             string                 `json:"bom-ref,omitempty"`
+	Name               string                 `json:"name"`
+	Version            string                 `json:"version,omitempty"`
+	Licenses           []cdxLicenseChoice     `json:"licenses,omitempty"`
+	Copyright          string                 `json:"copyright,omitempty"`
+	Purl               string                 `json:"purl,omitempty"`
+	ExternalReferences []cdxExternalReference `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty          `json:"properties,omitempty"`
+}
+
+// MarshalXML is needed since encoding/xml does not omit the empty
+// wrapping elements such as <licenses></licenses>.
+func (c cdxComponent) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type licenses struct {
+		License    []cdxLicense `xml:"license"`
+		Expression string       `xml:"expression,omitempty"`
+	}
+	type externalReferences struct {
+		Reference []cdxExternalReference `xml:"reference"`
+	}
+	type properties struct {
+		Property []cdxProperty `xml:"property"`
+	}
+	x := struct {
+		Type               string              `xml:"type,attr"`
+		BOMRef             string              `xml:"bom-ref,attr,omitempty"`
+		Name               string              `xml:"name"`
+		Version            string              `xml:"version,omitempty"`
+		Licenses           *licenses           `xml:"licenses,omitempty"`
+		Copyright          string              `xml:"copyright,omitempty"`
+		Purl               string              `xml:"purl,omitempty"`
+		ExternalReferences *externalReferences `xml:"externalReferences,omitempty"`
+		Properties         *properties         `xml:"properties,omitempty"`
+	}{
+		Type:      c.Type,
+		BOMRef:    c.BOMRef,
+		Name:      c.Name,
+		Version:   c.Version,
+		Copyright: c.Copyright,
+		Purl:      c.Purl,
+	}
+	if len(c.Licenses) > 0 {
+		x.Licenses = &licenses{}
+		for _, choice := range c.Licenses {
+			if choice.License != nil {
+				x.Licenses.License = append(x.Licenses.License, *choice.License)
+			}
+			x.Licenses.Expression = choice.Expression
+		}
+	}
+	if len(c.ExternalReferences) > 0 {
+		x.ExternalReferences = &externalReferences{Reference: c.ExternalReferences}
+	}
+	if len(c.Properties) > 0 {
+		x.Properties = &properties{Property: c.Properties}
+	}
+	return e.EncodeElement(x, start)
+}
+
+// A license choice is either a single license or an SPDX expression, in
+// which case it must be the only choice.
+type cdxLicenseChoice struct {
+	License    *cdxLicense `json:"license,omitempty"`
+	Expression string      `json:"expression,omitempty"`
+}
+
+type cdxLicense struct {
+	ID   string `json:"id,omitempty" xml:"id,omitempty"`
+	Name string `json:"name,omitempty" xml:"name,omitempty"`
+	URL  string `json:"url,omitempty" xml:"url,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name" xml:"name,attr"`
+	Value string `json:"value" xml:",chardata"`
+}
+
+type cdxExternalReference struct {
+	Type string `json:"type" xml:"type,attr"`
+	URL  string `json:"url" xml:"url"`
+}
+
+// The JSON encoding lists the dependencies as refs in DependsOn whereas the
+// XML encoding nests them as dependency elements.
+type cdxDependency struct {
+	Ref       string          `json:"ref" xml:"ref,attr"`
+	DependsOn []string        `json:"dependsOn" xml:"-"`
+	Children  []cdxDependency `json:"-" xml:"dependency"`
+}
+
+// WriteCycloneDXJSON writes the SBOM as a CycloneDX 1.5 JSON document.
+func (b *SBOM) WriteCycloneDXJSON(w io.Writer) error {
+	bom, err := b.cyclonedx()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bom)
+}
+
+// WriteCycloneDXXML writes the SBOM as a CycloneDX 1.5 XML document.
+func (b *SBOM) WriteCycloneDXXML(w io.Writer) error {
+	bom, err := b.cyclonedx()
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(bom); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func (b *SBOM) cyclonedx() (cdxBOM, error) {
+	serial, err := newUUID()
+	if err != nil {
+		return cdxBOM{}, fmt.Errorf("while generating the serial number: %w", err)
+	}
+
+	bom := cdxBOM{
+		XMLNS:        "http://cyclonedx.org/schema/bom/1.5",
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + serial,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools: cdxTools{Components: []cdxComponent{{
+				Type: "application",
+				Name: "go-providence-checker",
+			}}},
+			Component: cdxComponent{
+				Type:   "application",
+				BOMRef: modKey(b.Root),
+				Name:   b.Root.Path,
+			},
+		},
+		Components:   []cdxComponent{},
+		Dependencies: []cdxDependency{},
+	}
+
+	mains := 0
+	for _, m := range b.Modules {
+		if m.Main {
+			mains++
+		}
+	}
+
+	// The modules of a workspace are all main modules. They are then the
+	// applications that the workspace is made of.
+	refs := make(map[string]struct{})
+	for _, m := range b.Modules {
+		refs[modKey(m)] = struct{}{}
+		if m.Main && mains == 1 {
+			// The main module has no version in the build list.
+			bom.Metadata.Component = b.cdxComponent(m)
+			bom.Metadata.Component.Type = "application"
+			continue
+		}
+		c := b.cdxComponent(m)
+		if m.Main {
+			c.Type = "application"
+		}
+		bom.Components = append(bom.Components, c)
+	}
+
+	if mains > 1 {
+		dep := cdxDependency{Ref: modKey(b.Root), DependsOn: []string{}}
+		for _, to := range b.Graph[modKey(b.Root)] {
+			dep.DependsOn = append(dep.DependsOn, to)
+			dep.Children = append(dep.Children, cdxDependency{Ref: to})
+		}
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+	for _, m := range b.Modules {
+		dep := cdxDependency{Ref: modKey(m), DependsOn: []string{}}
+		for _, to := range b.Graph[modKey(m)] {
+			if _, ok := refs[to]; !ok {
+				continue
+			}
+			dep.DependsOn = append(dep.DependsOn, to)
+			dep.Children = append(dep.Children, cdxDependency{Ref: to})
+		}
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+
+	return bom, nil
+}
+
+func (b *SBOM) cdxComponent(m GoModuleInfo) cdxComponent {
+	// A local replacement has no package URL of its own.
+	src := source(m)
+	if IsLocalPath(src.Path) {
+		src = m
+	}
+
+	c := cdxComponent{
+		Type:    "library",
+		BOMRef:  modKey(m),
+		Name:    m.Path,
+		Version: m.Version,
+		Purl:    purl(src),
+	}
+
+	// The go.sum checksum is a hash of the file tree of the module, not of
+	// the zip of the distribution, so it isn't given as a hash.
+	if src.Sum != "" {
+		c.Properties = append(c.Properties, cdxProperty{Name: "go-providence-checker:go-sum", Value: src.Sum})
+	}
+	if loc := downloadLocation(m); loc != "" {
+		c.ExternalReferences = append(c.ExternalReferences, cdxExternalReference{Type: "distribution", URL: loc})
+	}
+
+	li, ok := b.Licenses[modKey(m)]
+	if !ok {
+		return c
+	}
+	// The id must be on the SPDX license list. The licenses of a module
+	// that has several are given as a single expression, in which the other
+	// licenses are "LicenseRef-" ids.
+	switch {
+	case len(li.Licenses) == 1:
+		license := cdxLicense{URL: li.Licenses[0].LinkToLicense}
+		if isSPDXLicenseID(li.Licenses[0].LicenseName) {
+			license.ID = li.Licenses[0].LicenseName
+		} else {
+			license.Name = li.Licenses[0].LicenseName
+		}
+		c.Licenses = []cdxLicenseChoice{{License: &license}}
+	case len(li.Licenses) > 1:
+		c.Licenses = []cdxLicenseChoice{{Expression: cdxExpression(li.LicenseName)}}
+	}
+	for _, m := range li.Licenses {
+		if m.LinkToLicense != "" {
+			c.ExternalReferences = append(c.ExternalReferences, cdxExternalReference{Type: "license", URL: m.LinkToLicense})
+		}
+	}
+	c.Copyright = strings.Join(li.Copyrights, "\n")
+	if li.ManuallyAsserted {
+		c.Properties = append(c.Properties, cdxProperty{Name: "go-providence-checker:license-source", Value: "manually asserted"})
+	}
+
+	return c
+}
+
+// cdxExpression turns the licenses of the expression that are not on the
+// SPDX license list into "LicenseRef-" ids, e.g. "Apache-2.0.header"
+// becomes "LicenseRef-Apache-2.0.header".
+func cdxExpression(expr string) string {
+	var terms []string
+	for _, term := range strings.Fields(expr) {
+		license := strings.Trim(term, "()")
+		switch {
+		case license == "AND" || license == "OR" || license == "WITH":
+		case isSPDXLicenseID(license) || spdxLicenseRef.MatchString(license):
+		case len(terms) > 0 && terms[len(terms)-1] == "WITH":
+		default:
+			term = strings.Replace(term, license, "LicenseRef-"+spdxInvalidIDChars.ReplaceAllString(license, "-"), 1)
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
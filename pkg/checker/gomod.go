@@ -0,0 +1,176 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jakexks/go-providence-checker/pkg/dirutil"
+)
+
+// GoMod is the root's go.mod as returned by 'go mod edit -json'.
+type GoMod struct {
+	Module  ModuleVersion   `json:"Module"`
+	Go      string          `json:"Go"`
+	Require []ModuleVersion `json:"Require"`
+	Replace []GoModReplace  `json:"Replace"`
+}
+
+type ModuleVersion struct {
+	Path    string `json:"Path"`
+	Version string `json:"Version"`
+}
+
+// GoModReplace is a replace directive. The Old version is empty when the
+// directive applies to every version of the module. The New version is
+// empty when the replacement is a local directory.
+type GoModReplace struct {
+	Old ModuleVersion `json:"Old"`
+	New ModuleVersion `json:"New"`
+}
+
+// IsLocal returns true when the replacement is a directory on the local
+// filesystem, e.g. "replace example.com/foo => ../foo".
+func (r GoModReplace) IsLocal() bool {
+	return IsLocalPath(r.New.Path)
+}
+
+func (m ModuleVersion) String() string {
+	if m.Version == "" {
+		return m.Path
+	}
+	return m.Path + "@" + m.Version
+}
+
+// GoModEdit parses the go.mod of the working directory.
+func (s *State) GoModEdit() (GoMod, error) {
+	args := []string{"mod", "edit", "-json"}
+	cmd := s.buildCmd("go", args...)
+	out, err := cmd.Output()
+	if err != nil {
+		return GoMod{}, fmt.Errorf("while running 'go %v': %w", args, err)
+	}
+
+	var gomod GoMod
+	if err := json.Unmarshal(out, &gomod); err != nil {
+		return GoMod{}, fmt.Errorf("parsing the output of 'go %v': %w", args, err)
+	}
+	return gomod, nil
+}
+
+// resolveReplaces makes sure that every replace directive of the root's
+// go.mod can be honored. The local replacements are relative to rootDir,
+// which is the root's original directory. Since the working directory may
+// be a copy of the root module, the relative replacements are rewritten
+// into absolute paths so that they keep pointing to the right place.
+func (s *State) resolveReplaces(rootDir string) error {
+	gomod, err := s.GoModEdit()
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, r := range gomod.Replace {
+		if !r.IsLocal() {
+			s.Log.Infof("module %s is replaced by %s", r.Old, r.New)
+			continue
+		}
+
+		dir := r.New.Path
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(rootDir, dir)
+		}
+		if !dirutil.Exists(filepath.Join(dir, "go.mod")) {
+			missing = append(missing, fmt.Sprintf("%s => %s", r.Old, r.New.Path))
+			continue
+		}
+		s.Log.Infof("module %s is replaced by the local directory %s", r.Old, dir)
+
+		if dir == r.New.Path || s.local {
+			continue
+		}
+		args := []string{"mod", "edit", "-replace", r.Old.String() + "=" + dir}
+		out, err := s.buildCmd("go", args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("while running 'go %v': %w: %s", args, err, string(out))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("the following replace directives point to directories that do not contain a go.mod, relative to '%s': %s. If the root module was downloaded, use a local checkout instead", rootDir, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// GoModGraph returns the module requirement graph of the working directory
+// as given by 'go mod graph'. Only the edges between the modules of the
+// build list are kept. The keys and values are of the form "path@version",
+// except for the main module that has no version.
+//
+// When the modules come from a binary, the graph is unknown and the main
+// module is given as depending on every other module. For an image, the
+// image depends on the main module of each of its binaries. A workspace
+// depends on each of its modules.
+func (s *State) GoModGraph(buildList []GoModuleInfo) (map[string][]string, error) {
+	if s.fromBinary {
+		return s.graph, nil
+	}
+
+	args := []string{"mod", "graph"}
+	cmd := s.buildCmd("go", args...)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("while running 'go %v': %w", args, err)
+	}
+
+	selected := make(map[string]string)
+	for _, m := range buildList {
+		selected[m.Path] = m.Version
+	}
+
+	graph := make(map[string][]string)
+	seen := make(map[string]struct{})
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		from, to := splitModVersion(fields[0]), splitModVersion(fields[1])
+
+		// Edges coming from versions that were not selected by the minimal
+		// version selection do not matter.
+		if v, ok := selected[from.Path]; !ok || v != from.Version {
+			continue
+		}
+		toVersion, ok := selected[to.Path]
+		if !ok {
+			continue
+		}
+		to.Version = toVersion
+
+		edge := from.String() + " " + to.String()
+		if _, found := seen[edge]; found {
+			continue
+		}
+		seen[edge] = struct{}{}
+		graph[from.String()] = append(graph[from.String()], to.String())
+	}
+
+	if s.workFile != "" {
+		graph[s.root.Path] = s.workspaceEdges()
+	}
+	for _, deps := range graph {
+		sort.Strings(deps)
+	}
+	return graph, nil
+}
+
+func splitModVersion(mod string) ModuleVersion {
+	i := strings.LastIndex(mod, "@")
+	if i < 0 {
+		return ModuleVersion{Path: mod}
+	}
+	return ModuleVersion{Path: mod[:i], Version: mod[i+1:]}
+}
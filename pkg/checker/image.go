@@ -0,0 +1,430 @@
+package checker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+)
+
+// ImageBinary is a Go binary found in the layers of a container image.
+type ImageBinary struct {
+	// Path is the absolute path of the binary in the image's filesystem.
+	Path      string
+	BuildInfo *debug.BuildInfo
+}
+
+// Image is a container image read from an OCI image layout or from the
+// output of 'docker save'.
+type Image struct {
+	// Name is the reference the image was saved with, or the base name of
+	// the path when the image has no reference.
+	Name     string
+	Binaries []ImageBinary
+}
+
+// InitImage prepares the state for analysing the Go binaries of a
+// container image. The path is either an OCI image layout directory or a
+// tarball of one, such as the output of 'docker save'. The modules of
+// every binary are merged, and the image is returned as the root module.
+// The platform of a multi-platform image is chosen with the goos and
+// goarch given to Init, and defaults to linux and the host's architecture.
+func (s *State) InitImage(path string) ([]GoModuleInfo, error) {
+	if err := s.setup(); err != nil {
+		return nil, err
+	}
+
+	workingDir, err := newTempDir()
+	if err != nil {
+		return nil, fmt.Errorf("creating temp working dir: %w", err)
+	}
+	s.workingDir = workingDir
+	s.fromBinary = true
+
+	img, err := s.ReadImage(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(img.Binaries) == 0 {
+		return nil, fmt.Errorf("no Go binary with build info was found in the image '%s'", path)
+	}
+
+	s.root = GoModuleInfo{Path: img.Name, Main: true}
+	s.graph = make(map[string][]string)
+	var modules []GoModuleInfo
+	seen := make(map[string]struct{})
+	for _, b := range img.Binaries {
+		s.Log.Infof("image %s: the binary %s was built with %s from the main module %s@%s", img.Name, b.Path, b.BuildInfo.GoVersion, b.BuildInfo.Main.Path, b.BuildInfo.Main.Version)
+
+		// The main module of each binary is a dependency of the image.
+		binModules := ModulesFromBuildInfo(b.BuildInfo)
+		binModules[0].Main = false
+		addBinaryGraph(s.graph, s.root, binModules[0], binModules[1:])
+
+		for _, m := range binModules {
+			if _, found := seen[modKey(m)]; found {
+				continue
+			}
+			seen[modKey(m)] = struct{}{}
+			modules = append(modules, m)
+		}
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		if modules[i].Path != modules[j].Path {
+			return modules[i].Path < modules[j].Path
+		}
+		return modules[i].Version < modules[j].Version
+	})
+
+	return s.download(append([]GoModuleInfo{s.root}, modules...))
+}
+
+// addBinaryGraph adds the edges from the parent to the main module of a
+// binary and from this main module to each of its dependencies. The edges
+// are kept sorted and without duplicates.
+func addBinaryGraph(graph map[string][]string, parent, main GoModuleInfo, deps []GoModuleInfo) {
+	add := func(from, to string) {
+		for _, existing := range graph[from] {
+			if existing == to {
+				return
+			}
+		}
+		graph[from] = append(graph[from], to)
+		sort.Strings(graph[from])
+	}
+
+	if parent.Path != "" {
+		add(modKey(parent), modKey(main))
+	}
+	for _, dep := range deps {
+		add(modKey(main), modKey(dep))
+	}
+}
+
+// ReadImage finds the Go binaries in the layers of the image. The layers
+// are applied in order, so a binary that is removed or replaced by a later
+// layer is not returned.
+func (s *State) ReadImage(path string) (*Image, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("while reading the image '%s': %w", path, err)
+	}
+	var fsys imageFS = dirImageFS(path)
+	if !info.IsDir() {
+		fsys = tarImageFS(path)
+	}
+
+	img := &Image{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+	layers, name, err := s.imageLayers(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("while reading the image '%s': %w", path, err)
+	}
+	if name != "" {
+		img.Name = name
+	}
+
+	binaries := make(map[string]ImageBinary)
+	for _, layer := range layers {
+		if err := readLayer(fsys, layer, binaries); err != nil {
+			return nil, fmt.Errorf("while reading the layer '%s' of the image '%s': %w", layer, path, err)
+		}
+	}
+
+	for _, b := range binaries {
+		img.Binaries = append(img.Binaries, b)
+	}
+	sort.Slice(img.Binaries, func(i, j int) bool { return img.Binaries[i].Path < img.Binaries[j].Path })
+
+	return img, nil
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform"`
+}
+
+// ociIndex is either an image index or an image manifest.
+type ociIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+type dockerManifest struct {
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// imageLayers returns the paths of the layers of the image, from the
+// lowest to the uppermost, and the reference the image was saved with.
+// The OCI image layout is preferred to the 'docker save' manifest.json
+// when both are present.
+func (s *State) imageLayers(fsys imageFS) (layers []string, name string, err error) {
+	var index ociIndex
+	err = readImageJSON(fsys, "index.json", &index)
+	if os.IsNotExist(err) {
+		var manifests []dockerManifest
+		if err := readImageJSON(fsys, "manifest.json", &manifests); err != nil {
+			if os.IsNotExist(err) {
+				return nil, "", fmt.Errorf("neither an OCI image layout nor the output of 'docker save': no index.json or manifest.json")
+			}
+			return nil, "", err
+		}
+		if len(manifests) != 1 {
+			return nil, "", fmt.Errorf("manifest.json must contain exactly one image, found %d", len(manifests))
+		}
+		if len(manifests[0].RepoTags) > 0 {
+			name = manifests[0].RepoTags[0]
+		}
+		return manifests[0].Layers, name, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	goos, goarch := "linux", runtime.GOARCH
+	if s.goos != "" {
+		goos = s.goos
+	}
+	if s.goarch != "" {
+		goarch = s.goarch
+	}
+
+	// An index may point to other indexes, such as a multi-platform image.
+	for len(index.Layers) == 0 {
+		var manifest *ociDescriptor
+		for i, d := range index.Manifests {
+			if d.Platform != nil && (d.Platform.OS != goos || d.Platform.Architecture != goarch) {
+				continue
+			}
+			if manifest != nil {
+				return nil, "", fmt.Errorf("the image contains several manifests for the platform %s/%s", goos, goarch)
+			}
+			manifest = &index.Manifests[i]
+		}
+		if manifest == nil {
+			return nil, "", fmt.Errorf("the image has no manifest for the platform %s/%s", goos, goarch)
+		}
+		if ref := manifest.Annotations["org.opencontainers.image.ref.name"]; ref != "" && name == "" {
+			name = ref
+		}
+
+		blob, err := blobPath(manifest.Digest)
+		if err != nil {
+			return nil, "", err
+		}
+		index = ociIndex{}
+		if err := readImageJSON(fsys, blob, &index); err != nil {
+			return nil, "", err
+		}
+		if len(index.Layers) == 0 && len(index.Manifests) == 0 {
+			return nil, "", fmt.Errorf("the manifest %s has no layers", manifest.Digest)
+		}
+	}
+
+	for _, l := range index.Layers {
+		if strings.Contains(l.MediaType, "zstd") {
+			return nil, "", fmt.Errorf("the layer %s is compressed with zstd, which is not supported", l.Digest)
+		}
+		blob, err := blobPath(l.Digest)
+		if err != nil {
+			return nil, "", err
+		}
+		layers = append(layers, blob)
+	}
+	return layers, name, nil
+}
+
+// blobPath turns a digest such as "sha256:abc" into "blobs/sha256/abc".
+func blobPath(digest string) (string, error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(digest, "/\\") {
+		return "", fmt.Errorf("invalid digest '%s'", digest)
+	}
+	return path.Join("blobs", parts[0], parts[1]), nil
+}
+
+func readImageJSON(fsys imageFS, name string, v interface{}) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("while parsing '%s': %w", name, err)
+	}
+	return nil
+}
+
+// The magic numbers of the executable formats supported by debug/buildinfo:
+// ELF, PE, Mach-O (32 and 64 bits, both endiannesses) and XCOFF.
+var executableMagics = [][]byte{
+	[]byte("\x7FELF"),
+	[]byte("MZ"),
+	[]byte("\xFE\xED\xFA\xCE"),
+	[]byte("\xFE\xED\xFA\xCF"),
+	[]byte("\xCE\xFA\xED\xFE"),
+	[]byte("\xCF\xFA\xED\xFE"),
+	{0x01, 0xDF},
+	{0x01, 0xF7},
+}
+
+// readLayer applies a layer on top of the binaries found in the lower
+// layers. The whiteout files of the layer remove the binaries of the lower
+// layers.
+func readLayer(fsys imageFS, layer string, binaries map[string]ImageBinary) error {
+	f, err := fsys.Open(layer)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := decompress(f)
+	if err != nil {
+		return err
+	}
+
+	added := make(map[string]ImageBinary)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Join("/", hdr.Name)
+		dir, base := path.Split(name)
+
+		switch {
+		case base == ".wh..wh..opq":
+			removeUnder(binaries, path.Clean(dir))
+			continue
+		case strings.HasPrefix(base, ".wh."):
+			removed := path.Join(dir, strings.TrimPrefix(base, ".wh."))
+			delete(binaries, removed)
+			removeUnder(binaries, removed)
+			continue
+		}
+
+		// A file of this layer hides the file of the lower layers, be it
+		// a Go binary or not.
+		delete(binaries, name)
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		br := bufio.NewReader(tr)
+		magic, _ := br.Peek(4)
+		executable := false
+		for _, m := range executableMagics {
+			if bytes.HasPrefix(magic, m) {
+				executable = true
+				break
+			}
+		}
+		if !executable {
+			continue
+		}
+		content, err := ioutil.ReadAll(br)
+		if err != nil {
+			return fmt.Errorf("while reading '%s': %w", name, err)
+		}
+		bi, err := buildinfo.Read(bytes.NewReader(content))
+		if err != nil {
+			// Not a Go binary, or one built without module support.
+			continue
+		}
+		added[name] = ImageBinary{Path: name, BuildInfo: bi}
+	}
+
+	for name, b := range added {
+		binaries[name] = b
+	}
+	return nil
+}
+
+func removeUnder(binaries map[string]ImageBinary, dir string) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for name := range binaries {
+		if strings.HasPrefix(name, prefix) {
+			delete(binaries, name)
+		}
+	}
+}
+
+// decompress returns a reader of the uncompressed content, which is
+// detected to be gzipped or not from its first bytes.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return gzip.NewReader(br)
+	}
+	return br, nil
+}
+
+// imageFS gives access to the files of an image, be it a directory or a
+// tarball. The names use forward slashes.
+type imageFS interface {
+	Open(name string) (io.ReadCloser, error)
+}
+
+type dirImageFS string
+
+func (d dirImageFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// tarImageFS reads the files of an image from a tarball, which may be
+// gzipped. The tarball is scanned every time a file is opened.
+type tarImageFS string
+
+func (t tarImageFS) Open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(string(t))
+	if err != nil {
+		return nil, err
+	}
+	r, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("while reading the tarball '%s': %w", string(t), err)
+		}
+		if path.Clean(hdr.Name) == path.Clean(name) {
+			return struct {
+				io.Reader
+				io.Closer
+			}{tr, f}, nil
+		}
+	}
+	f.Close()
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+}
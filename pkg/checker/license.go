@@ -8,18 +8,32 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/go-enry/go-license-detector/v4/licensedb"
+	"github.com/go-enry/go-license-detector/v4/licensedb/filer"
 	"github.com/google/licenseclassifier"
 	classifier "github.com/google/licenseclassifier/v2"
 )
 
+// The detectors that may be used by Classify.
+const (
+	DetectorGoLicenseDetector = "go-license-detector"
+	DetectorLicenseClassifier = "licenseclassifier"
+)
+
 var (
 	licenseFileRegex      = regexp.MustCompile(`^(?i)(LICEN(S|C)E|COPYING|README|NOTICE)(\\..+)?$`)
+	subdirLicenseRegex    = regexp.MustCompile(`^(?i)(LICEN(S|C)E|COPYING)([.-].+)?$`)
 	ErrNoLicenseFileFound = errors.New("not able to find a license file in this directory")
 )
 
+// LicenseInfo describes the license of a module. When several licenses are
+// found, LicenseName is an SPDX expression such as "MIT OR Apache-2.0" and
+// LicenseType is the type that applies to the expression as a whole. The
+// LicenseFile, LinkToLicense and Confidence are those of the license found
+// with the highest confidence.
 type LicenseInfo struct {
 	LibraryName    string
 	LibraryVersion string
@@ -28,10 +42,98 @@ type LicenseInfo struct {
 	LinkToLicense  string
 	LicenseName    string
 	LicenseType    string
+
+	// Confidence is between 0 and 1 and is given by the Detector that
+	// found the license.
+	Confidence float64
+	Detector   string
+
+	// Licenses lists every license found in the module.
+	Licenses []LicenseMatch
+
+	// Copyrights are the copyright lines found in the license files and in
+	// the headers of the source files.
+	Copyrights []string
+
+	// NoticeFiles are the NOTICE files that must be redistributed along
+	// with an Apache-2.0 license.
+	NoticeFiles []string
+
+	// ManuallyAsserted is true when the license comes from the overrides
+	// file instead of being detected.
+	ManuallyAsserted bool
+
+	// When the library is replaced in the root's go.mod, the license is
+	// the replacement's license. ReplacementVersion is empty when the
+	// replacement is a local directory.
+	ReplacementName    string
+	ReplacementVersion string
+}
+
+// LicenseMatch is one of the licenses found in a module.
+type LicenseMatch struct {
+	LicenseName   string
+	LicenseType   string
+	LicenseFile   string
+	LinkToLicense string
+	Confidence    float64
+
+	// Dir is the directory of the license file relative to the module's
+	// root, e.g. "." or "third_party/forked/golang".
+	Dir string
+
+	// Packages are the imported packages that this license governs. It is
+	// only set when the analysis is done at the package level.
+	Packages []string
 }
 
+// Replacement returns the module replacing the library, or an empty string
+// when the library isn't replaced.
+func (li LicenseInfo) Replacement() string {
+	return ModuleVersion{Path: li.ReplacementName, Version: li.ReplacementVersion}.String()
+}
+
+// Classify returns the licenses of the module. The results are cached on
+// disk unless --no-cache is given. It is safe for concurrent use.
 func (s *State) Classify(info GoModuleInfo) (LicenseInfo, error) {
-	license, err := fastClassify(info)
+	if o, found := findOverride(s.overrides, info); found {
+		s.Log.Infof("%s: using the license %s manually asserted in the overrides file", info.Path, o.License)
+		return overrideLicenseInfo(info, o), nil
+	}
+	if info.Dir == "" {
+		return LicenseInfo{}, fmt.Errorf("the source code of the module %s@%s is not available", info.Path, info.Version)
+	}
+
+	key := ""
+	if s.cache != nil {
+		key = cacheKey(info, s.threshold, s.corpus)
+	}
+	if key != "" {
+		if li, found := s.cache.Get(key); found {
+			s.Log.Debugf("%s: using the cached classification", info.Path)
+			return li, nil
+		}
+	}
+
+	li, err := s.classify(info)
+	if err == nil && key != "" {
+		if err := s.cache.Put(key, li); err != nil {
+			s.Log.Infof("%s: could not cache the classification: %v", info.Path, err)
+		}
+	}
+	return li, err
+}
+
+func (s *State) classify(info GoModuleInfo) (LicenseInfo, error) {
+	license, err := s.detect(info)
+	if err == nil {
+		applyCustomTypes(&license, s.custom)
+	}
+	return license, err
+}
+
+func (s *State) detect(info GoModuleInfo) (LicenseInfo, error) {
+	license, err := fastClassify(info, s.threshold, s.custom)
 	if err == nil {
 		return license, nil
 	}
@@ -41,7 +143,12 @@ func (s *State) Classify(info GoModuleInfo) (LicenseInfo, error) {
 
 	s.Log.Infof("%s: go-license-detector didn't find anything, falling back to google/licenseclassifier", info.Path)
 
-	license, err = deepClassify(s.classifier, info)
+	// Loading the classifier is slow, and it is rarely needed.
+	c, err := s.loadClassifier()
+	if err != nil {
+		return LicenseInfo{}, err
+	}
+	license, err = deepClassify(c, info, s.threshold)
 	if err == nil {
 		return license, nil
 	}
@@ -54,10 +161,12 @@ func (s *State) Classify(info GoModuleInfo) (LicenseInfo, error) {
 }
 
 // Returns ErrNoLicenseFileFound when no license can be found in the
-// module's tree.
-func fastClassify(info GoModuleInfo) (LicenseInfo, error) {
+// module's tree. Besides the license with the highest confidence, the
+// licenses with a confidence above the threshold are also kept. The files
+// that contain the text of a custom license are given that license.
+func fastClassify(info GoModuleInfo, threshold float64, custom []CustomLicense) (LicenseInfo, error) {
 	// A single result is returned since we give a single directory.
-	results := licensedb.Analyse(info.Dir)
+	results := analyse(info.Dir)
 	if len(results) == 0 {
 		return LicenseInfo{}, errors.New("developer mistake since one result = one dir")
 	}
@@ -66,37 +175,482 @@ func fastClassify(info GoModuleInfo) (LicenseInfo, error) {
 
 	switch result.ErrStr {
 	case "no license file was found":
-		return LicenseInfo{}, ErrNoLicenseFileFound
+		// A custom license may still be found.
 	case "":
 		// No error, let's continue.
 	default:
 		return LicenseInfo{}, fmt.Errorf("using go-license-detector: %s", result.ErrStr)
 	}
 
-	if len(matches) == 0 {
+	// The subdirectories, such as vendored or forked code, may come with
+	// their own license.
+	subdirs, err := subdirsWithLicense(info.Dir, info.VendorDirs)
+	if err != nil {
+		return LicenseInfo{}, err
+	}
+
+	customs := customCandidates(custom, info.Dir, subdirs)
+	rootCustom := false
+	for _, c := range customs {
+		if filepath.Dir(c.path) == info.Dir {
+			rootCustom = true
+		}
+	}
+	if len(matches) == 0 && !rootCustom {
 		return LicenseInfo{}, ErrNoLicenseFileFound
 	}
+	if len(subdirs) > 0 {
+		for _, r := range analyse(subdirs...) {
+			if r.ErrStr != "" {
+				continue
+			}
+			results = append(results, r)
+		}
+	}
 
 	var candidates []candidate
-	for _, match := range matches {
-		candidates = append(candidates, candidate{
-			license:    match.License,
-			confidence: float64(match.Confidence),
-			path:       filepath.Join(result.Arg, match.File),
-		})
+	for _, result := range results {
+		for _, match := range result.Matches {
+			candidates = append(candidates, candidate{
+				license:    match.License,
+				confidence: float64(match.Confidence),
+				path:       filepath.Join(result.Arg, match.File),
+			})
+		}
+	}
+	candidates = withCustomCandidates(candidates, customs)
+
+	candidates, governed := governingCandidates(info, candidates)
+	if len(candidates) == 0 {
+		return LicenseInfo{}, ErrNoLicenseFileFound
+	}
+
+	return newLicenseInfo(info, candidates, governed, threshold, DetectorGoLicenseDetector), nil
+}
+
+// analyse is licensedb.Analyse, except that only the files at the top
+// level of each directory are looked into: the subdirectories usually hold
+// a corpus of license texts, such as the licenses/ directory of a license
+// detector, or code with its own license, which subdirsWithLicense finds.
+// The directories are analysed one after the other since the modules are
+// already classified in parallel.
+func analyse(dirs ...string) []licensedb.Result {
+	results := make([]licensedb.Result, len(dirs))
+	for i, dir := range dirs {
+		results[i] = analyseDir(dir)
+	}
+	return results
+}
+
+func analyseDir(dir string) licensedb.Result {
+	result := licensedb.Result{Arg: dir}
+	f, err := filer.FromDirectory(dir)
+	if err != nil {
+		result.ErrStr = err.Error()
+		return result
+	}
+	defer f.Close()
+	found, err := licensedb.Detect(topLevelFiler{f})
+	if err != nil {
+		result.ErrStr = err.Error()
+		return result
 	}
+	for license, m := range found {
+		result.Matches = append(result.Matches, licensedb.Match{License: license, Confidence: m.Confidence, File: m.File})
+	}
+	sort.Slice(result.Matches, func(a, b int) bool {
+		return result.Matches[a].Confidence > result.Matches[b].Confidence
+	})
+	return result
+}
+
+// topLevelFiler hides the subdirectories of the top-level directory.
+type topLevelFiler struct {
+	filer.Filer
+}
+
+func (f topLevelFiler) ReadDir(path string) ([]filer.File, error) {
+	files, err := f.Filer.ReadDir(path)
+	if err != nil || path != "" {
+		return files, err
+	}
+	var kept []filer.File
+	for _, file := range files {
+		if !file.IsDir {
+			kept = append(kept, file)
+		}
+	}
+	return kept, nil
+}
+
+// subdirsWithLicense returns the subdirectories of the module that contain
+// a LICENSE or COPYING file, leaving out the directories that are not part
+// of the module. The vendored modules are given by vendorDirs.
+func subdirsWithLicense(root string, vendorDirs map[string]struct{}) ([]string, error) {
+	var dirs []string
+	seen := make(map[string]struct{})
+	err := filepath.Walk(root, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fileInfo.IsDir() {
+			if path != root && skipDir(path, vendorDirs) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dir := filepath.Dir(path)
+		if dir == root || !subdirLicenseRegex.MatchString(fileInfo.Name()) {
+			return nil
+		}
+		if _, found := seen[dir]; !found {
+			seen[dir] = struct{}{}
+			dirs = append(dirs, dir)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking the tree starting at '%s': %w", root, err)
+	}
+	return dirs, nil
+}
+
+// skipDir returns true for the subdirectories whose license files don't
+// apply to the module: the testdata and the "_" directories are never
+// built, the vendor directory holds the code of other modules, and the
+// nested modules, which have a go.mod or are among the vendored modules
+// given by vendorDirs, are not part of the module.
+func skipDir(path string, vendorDirs map[string]struct{}) bool {
+	name := filepath.Base(path)
+	if name == "testdata" || name == "vendor" || name == ".git" || strings.HasPrefix(name, "_") {
+		return true
+	}
+	if _, found := vendorDirs[path]; found {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(path, "go.mod"))
+	return err == nil
+}
+
+// isLicenseFile returns true for the files named like LICENSE or COPYING,
+// as opposed to the README, NOTICE and other files in which a license may
+// be detected. The LICENSE.docs files, which Docker uses for the license
+// of its documentation, are left out.
+func isLicenseFile(path string) bool {
+	name := filepath.Base(path)
+	return subdirLicenseRegex.MatchString(name) && !strings.HasSuffix(name, "LICENSE.docs")
+}
+
+// The governed packages are given by governingCandidates.
+func newLicenseInfo(info GoModuleInfo, candidates []candidate, governed map[string][]string, threshold float64, detector string) LicenseInfo {
+	// The detectors return the candidates with the same confidence in a
+	// random order, e.g., GPL-3.0-only and GPL-3.0-or-later for the same
+	// file. Sorting them first keeps the results the same from run to run.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].path != candidates[j].path {
+			return candidates[i].path < candidates[j].path
+		}
+		return candidates[i].license < candidates[j].license
+	})
 
 	highest := highestConfidence(candidates)
+	matches := licenseMatches(info, candidates, highest, threshold)
+	for i := range matches {
+		matches[i].Packages = governed[filepath.Dir(matches[i].LicenseFile)]
+	}
 
-	return LicenseInfo{
+	li := LicenseInfo{
 		LibraryName:    info.Path,
 		LibraryVersion: info.Version,
 		LicenseFile:    highest.path,
-		LicenseType:    licenseType(highest.license),
+		LicenseType:    expressionType(matches),
 		SourceDir:      info.Dir,
-		LinkToLicense:  createLink(info.Path, info.Version, strings.TrimPrefix(highest.path, info.Dir+"/")),
-		LicenseName:    licenseName(highest.license),
-	}, nil
+		LinkToLicense:  linkToLicense(info, highest.path),
+		LicenseName:    expression(matches),
+		Confidence:     highest.confidence,
+		Detector:       detector,
+		Licenses:       matches,
+	}
+
+	var licenseFiles []string
+	for _, m := range matches {
+		licenseFiles = append(licenseFiles, m.LicenseFile)
+	}
+	li.Copyrights = copyrights(info, licenseFiles)
+	li.NoticeFiles = noticeFiles(info, matches)
+
+	if info.Replace != nil {
+		li.ReplacementName = info.Replace.Path
+		li.ReplacementVersion = info.Replace.Version
+	}
+
+	return li
+}
+
+// linkToLicense returns the upstream URL of the license file. When the
+// module is replaced, the link points to the replacement. A local
+// replacement has no version and thus no upstream link.
+func linkToLicense(info GoModuleInfo, path string) string {
+	src := info
+	if info.Replace != nil {
+		src = *info.Replace
+		if src.Version == "" {
+			return ""
+		}
+	}
+	return createLink(src.Path, src.Version, strings.TrimPrefix(path, info.Dir+"/"))
+}
+
+// licenseMatches keeps the highest candidate as well as the candidates
+// above the threshold that were found in license files. A single license
+// is kept per file and per license name, the license files at the root of
+// the module being preferred.
+func licenseMatches(info GoModuleInfo, candidates []candidate, highest candidate, threshold float64) []LicenseMatch {
+	var kept []candidate
+	for _, c := range candidates {
+		if c == highest || (c.confidence >= threshold && isLicenseFile(c.path)) {
+			kept = append(kept, c)
+		}
+	}
+
+	dir := func(c candidate) string {
+		rel, err := filepath.Rel(info.Dir, filepath.Dir(c.path))
+		if err != nil {
+			return "."
+		}
+		return rel
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		if (dir(kept[i]) == ".") != (dir(kept[j]) == ".") {
+			return dir(kept[i]) == "."
+		}
+		if kept[i] == highest || kept[j] == highest {
+			return kept[i] == highest
+		}
+		return kept[i].confidence > kept[j].confidence
+	})
+
+	var matches []LicenseMatch
+	seenFiles := make(map[string]struct{})
+	seenLicenses := make(map[string]struct{})
+	for _, c := range kept {
+		name := licenseName(c.license)
+		if _, found := seenFiles[c.path]; found {
+			continue
+		}
+		if _, found := seenLicenses[name]; found {
+			continue
+		}
+		seenFiles[c.path] = struct{}{}
+		seenLicenses[name] = struct{}{}
+
+		matches = append(matches, LicenseMatch{
+			LicenseName:   name,
+			LicenseType:   licenseType(c.license),
+			LicenseFile:   c.path,
+			LinkToLicense: linkToLicense(info, c.path),
+			Confidence:    c.confidence,
+			Dir:           dir(c),
+		})
+	}
+
+	return matches
+}
+
+// expression combines the licenses into an SPDX expression. The licenses
+// found at the root of the module are alternatives when they are dual
+// licenses, e.g. a LICENSE-MIT next to a LICENSE-APACHE, whereas the other
+// licenses apply in addition, e.g. "(MIT OR Apache-2.0) AND BSD-3-Clause".
+func expression(matches []LicenseMatch) string {
+	var root, sub []string
+	for _, m := range matches {
+		if m.Dir == "." {
+			root = append(root, m.LicenseName)
+		} else {
+			sub = append(sub, m.LicenseName)
+		}
+	}
+
+	var terms []string
+	switch {
+	case len(root) > 1 && dualLicensed(matches) && len(sub) == 0:
+		terms = append(terms, strings.Join(root, " OR "))
+	case len(root) > 1 && dualLicensed(matches):
+		terms = append(terms, "("+strings.Join(root, " OR ")+")")
+	default:
+		terms = append(terms, root...)
+	}
+	terms = append(terms, sub...)
+
+	return strings.Join(terms, " AND ")
+}
+
+var suffixedLicenseFileRegex = regexp.MustCompile(`^(?i)(?:LICEN[SC]E|COPYING)[.-](.+?)(?:\.(?:txt|md|rst|html))?$`)
+
+// dualLicensed returns true when the license files at the root of the
+// module are each named after their license, such as LICENSE-MIT and
+// LICENSE-APACHE, which is how a choice between licenses is usually
+// offered. Otherwise, such as with a LICENSE and a LICENSE.libyaml for the
+// code ported from libyaml, the licenses all apply.
+func dualLicensed(matches []LicenseMatch) bool {
+	normalize := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return -1
+		}, strings.ToLower(s))
+	}
+	for _, m := range matches {
+		if m.Dir != "." {
+			continue
+		}
+		parts := suffixedLicenseFileRegex.FindStringSubmatch(filepath.Base(m.LicenseFile))
+		if parts == nil {
+			return false
+		}
+		suffix, license := normalize(parts[1]), normalize(m.LicenseName)
+		if suffix == "" || !strings.HasPrefix(license, suffix) && !strings.HasPrefix(suffix, license) {
+			return false
+		}
+	}
+	return true
+}
+
+// The license types from the least to the most restrictive.
+var licenseTypeOrder = []string{"unencumbered", "permissive", "notice", "reciprocal", "restricted", "by_exception_only", "forbidden"}
+
+func restrictiveness(licenseType string) int {
+	for i, t := range licenseTypeOrder {
+		if t == licenseType {
+			return i
+		}
+	}
+	return len(licenseTypeOrder)
+}
+
+// expressionType returns the type that applies to the expression: the
+// least restrictive of the alternatives, combined with the most
+// restrictive of the licenses that apply in addition.
+func expressionType(matches []LicenseMatch) string {
+	var root, result string
+	if dualLicensed(matches) {
+		for _, m := range matches {
+			if m.Dir == "." && (root == "" || restrictiveness(m.LicenseType) < restrictiveness(root)) {
+				root = m.LicenseType
+			}
+		}
+	}
+	result = root
+	for _, m := range matches {
+		if (m.Dir != "." || root == "") && (result == "" || restrictiveness(m.LicenseType) > restrictiveness(result)) {
+			result = m.LicenseType
+		}
+	}
+	return result
+}
+
+// spdxExpressionType returns the type that applies to an SPDX expression
+// given as text, such as "(MIT OR GPL-2.0-only) AND BSD-3-Clause": the
+// least restrictive of the alternatives, and the most restrictive of the
+// licenses that apply together. A malformed expression is restricted.
+func spdxExpressionType(expr string) string {
+	return evalExpressionType(expr, licenseType)
+}
+
+// RestrictedNotLGPL returns true when a restricted license other than the
+// LGPL applies to the module, leaving out the restricted licenses that are
+// alternatives to a less restrictive license or to the LGPL.
+func (li LicenseInfo) RestrictedNotLGPL() bool {
+	t := evalExpressionType(li.LicenseName, func(license string) string {
+		t := licenseType(license)
+		for _, m := range li.Licenses {
+			if m.LicenseName == license {
+				t = m.LicenseType
+			}
+		}
+		// Linking to an LGPL module only requires to give its source code,
+		// as a reciprocal license would.
+		if t == "restricted" && strings.HasPrefix(license, "LGPL") {
+			return "reciprocal"
+		}
+		return t
+	})
+	return t == "restricted"
+}
+
+func evalExpressionType(expr string, typeOf func(license string) string) string {
+	p := expressionParser{tokens: strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr)), typeOf: typeOf}
+	t, ok := p.or()
+	if !ok || p.pos != len(p.tokens) {
+		return "restricted"
+	}
+	return t
+}
+
+type expressionParser struct {
+	tokens []string
+	pos    int
+	typeOf func(license string) string
+}
+
+func (p *expressionParser) next() string {
+	if p.pos == len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *expressionParser) or() (string, bool) {
+	result, ok := p.and()
+	for ok && strings.ToUpper(p.next()) == "OR" {
+		p.pos++
+		var t string
+		t, ok = p.and()
+		if restrictiveness(t) < restrictiveness(result) {
+			result = t
+		}
+	}
+	return result, ok
+}
+
+func (p *expressionParser) and() (string, bool) {
+	result, ok := p.license()
+	for ok && strings.ToUpper(p.next()) == "AND" {
+		p.pos++
+		var t string
+		t, ok = p.license()
+		if restrictiveness(t) > restrictiveness(result) {
+			result = t
+		}
+	}
+	return result, ok
+}
+
+// license parses a license, which may be followed by an exception that
+// doesn't change its type, or a parenthesized expression.
+func (p *expressionParser) license() (string, bool) {
+	switch token := p.next(); token {
+	case "", ")":
+		return "", false
+	case "(":
+		p.pos++
+		t, ok := p.or()
+		if !ok || p.next() != ")" {
+			return "", false
+		}
+		p.pos++
+		return t, true
+	default:
+		p.pos++
+		if strings.ToUpper(p.next()) == "WITH" {
+			p.pos += 2
+			if p.pos > len(p.tokens) {
+				return "", false
+			}
+		}
+		return p.typeOf(token), true
+	}
 }
 
 type candidate struct {
@@ -126,13 +680,16 @@ func highestConfidence(c []candidate) candidate {
 
 // Use Google's slow licenseclassifier to find the possible licenses in the
 // whole project's directory tree.
-func deepClassify(c *classifier.Classifier, info GoModuleInfo) (LicenseInfo, error) {
+func deepClassify(c *classifier.Classifier, info GoModuleInfo, threshold float64) (LicenseInfo, error) {
 	var licenseFiles []string
 	err := filepath.Walk(info.Dir, func(path string, fileInfo os.FileInfo, err error) error {
 		if err != nil {
 			return fmt.Errorf("walking the tree starting at '%s': %w", info.Dir, err)
 		}
 		if fileInfo.IsDir() {
+			if path != info.Dir && skipDir(path, info.VendorDirs) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 		if !licenseFileRegex.MatchString(fileInfo.Name()) {
@@ -161,21 +718,12 @@ func deepClassify(c *classifier.Classifier, info GoModuleInfo) (LicenseInfo, err
 		}
 	}
 
+	candidates, governed := governingCandidates(info, candidates)
 	if len(candidates) == 0 {
 		return LicenseInfo{}, ErrNoLicenseFileFound
 	}
 
-	highest := highestConfidence(candidates)
-
-	return LicenseInfo{
-		LibraryName:    info.Path,
-		LibraryVersion: info.Version,
-		LicenseFile:    highest.path,
-		LicenseType:    licenseType(highest.license),
-		SourceDir:      info.Dir,
-		LinkToLicense:  createLink(info.Path, info.Version, strings.TrimPrefix(highest.path, info.Dir+"/")),
-		LicenseName:    licenseName(highest.license),
-	}, nil
+	return newLicenseInfo(info, candidates, governed, threshold, DetectorLicenseClassifier), nil
 }
 
 func licenseType(license string) string {
@@ -0,0 +1,112 @@
+package checker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readTestLicense(t *testing.T, name string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile(filepath.Join("..", "..", "licenses", name+".txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// vendorWithNestedModules writes a vendor directory in which the modules
+// cloud.google.com/go/storage and cloud.google.com/go/pubsub are nested in
+// cloud.google.com/go, and returns the directories of the vendored modules.
+func vendorWithNestedModules(t *testing.T) (string, map[string]struct{}) {
+	vendor := filepath.Join(t.TempDir(), "vendor")
+	parent := filepath.Join(vendor, "cloud.google.com", "go")
+	storage := filepath.Join(parent, "storage")
+	pubsub := filepath.Join(parent, "pubsub")
+
+	writeTestFile(t, filepath.Join(parent, "LICENSE"), readTestLicense(t, "Apache-2.0"))
+	writeTestFile(t, filepath.Join(parent, "civil", "civil.go"), "// Copyright 2016 Google LLC\n\npackage civil\n")
+
+	writeTestFile(t, filepath.Join(storage, "LICENSE"), readTestLicense(t, "MIT"))
+	writeTestFile(t, filepath.Join(storage, "NOTICE"), "Storage\nCopyright 2021 Storage Authors\n")
+	writeTestFile(t, filepath.Join(storage, "storage.go"), "// Copyright 2021 Storage Authors\n\npackage storage\n")
+	writeTestFile(t, filepath.Join(storage, "internal", "forked", "LICENSE"), readTestLicense(t, "BSD-3-Clause"))
+
+	writeTestFile(t, filepath.Join(pubsub, "COPYING"), readTestLicense(t, "BSD-3-Clause"))
+	writeTestFile(t, filepath.Join(pubsub, "pubsub.go"), "// Copyright 2022 Pubsub Authors\n\npackage pubsub\n")
+
+	dirs := map[string]struct{}{parent: {}, storage: {}, pubsub: {}}
+	return parent, dirs
+}
+
+func TestSubdirsWithLicenseNestedVendoredModules(t *testing.T) {
+	parent, dirs := vendorWithNestedModules(t)
+	tests := []struct {
+		name string
+		root string
+		want []string
+	}{
+		{name: "parent module", root: parent},
+		{name: "nested module", root: filepath.Join(parent, "storage"), want: []string{filepath.Join(parent, "storage", "internal", "forked")}},
+		{name: "nested module without subdirectory", root: filepath.Join(parent, "pubsub")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := subdirsWithLicense(tt.root, dirs)
+			if err != nil {
+				t.Fatalf("subdirsWithLicense() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("subdirsWithLicense() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFastClassifyNestedVendoredModules(t *testing.T) {
+	parent, dirs := vendorWithNestedModules(t)
+	tests := []struct {
+		name           string
+		info           GoModuleInfo
+		wantLicense    string
+		wantCopyrights []string
+		wantNotices    []string
+	}{
+		{
+			name:           "parent module",
+			info:           GoModuleInfo{Path: "cloud.google.com/go", Version: "v0.100.0", Dir: parent, VendorDirs: dirs},
+			wantLicense:    "Apache-2.0",
+			wantCopyrights: []string{"Copyright 2016 Google LLC"},
+		},
+		{
+			name:           "nested module",
+			info:           GoModuleInfo{Path: "cloud.google.com/go/storage", Version: "v1.0.0", Dir: filepath.Join(parent, "storage"), VendorDirs: dirs},
+			wantLicense:    "MIT AND BSD-3-Clause",
+			wantCopyrights: []string{"Copyright 2021 Storage Authors"},
+		},
+		{
+			name:           "other nested module",
+			info:           GoModuleInfo{Path: "cloud.google.com/go/pubsub", Version: "v1.0.0", Dir: filepath.Join(parent, "pubsub"), VendorDirs: dirs},
+			wantLicense:    "BSD-3-Clause",
+			wantCopyrights: []string{"Copyright 2022 Pubsub Authors"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			li, err := fastClassify(tt.info, 0.9, nil)
+			if err != nil {
+				t.Fatalf("fastClassify() error = %v", err)
+			}
+			if li.LicenseName != tt.wantLicense {
+				t.Errorf("fastClassify() license = %s, want %s", li.LicenseName, tt.wantLicense)
+			}
+			if !reflect.DeepEqual(li.Copyrights, tt.wantCopyrights) {
+				t.Errorf("fastClassify() copyrights = %q, want %q", li.Copyrights, tt.wantCopyrights)
+			}
+			if !reflect.DeepEqual(li.NoticeFiles, tt.wantNotices) {
+				t.Errorf("fastClassify() notice files = %q, want %q", li.NoticeFiles, tt.wantNotices)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package checker
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// LoadManifest reads the list of root modules from a manifest file such
+// as:
+//
+//	roots:
+//	  - github.com/jetstack/cert-manager@v1.3.0
+//	  - github.com/jetstack/google-cas-issuer
+//	  - ./preflight
+//
+// The local directories are relative to the manifest file. The format is
+// guessed from the file extension.
+func LoadManifest(path string) ([]string, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading the manifest file '%s': %w", path, err)
+	}
+
+	var file struct {
+		Roots []string `mapstructure:"roots"`
+	}
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, fmt.Errorf("parsing the manifest file '%s': %w", path, err)
+	}
+	if len(file.Roots) == 0 {
+		return nil, fmt.Errorf("manifest file '%s': the 'roots' list is empty", path)
+	}
+
+	for i, root := range file.Roots {
+		if !IsLocalPath(root) {
+			continue
+		}
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(filepath.Dir(path), root)
+		}
+		// An absolute path is needed for the root to still be seen as a
+		// local directory.
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("manifest file '%s': while resolving the absolute path of '%s': %w", path, root, err)
+		}
+		file.Roots[i] = abs
+	}
+
+	return file.Roots, nil
+}
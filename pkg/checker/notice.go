@@ -0,0 +1,97 @@
+package checker
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var noticeFileRegex = regexp.MustCompile(`^(?i)NOTICE(\.(txt|md))?$`)
+
+// noticeFiles returns the NOTICE files that the Apache-2.0 license, in its
+// section 4(d), requires to redistribute. They are looked for at the root
+// of the module and next to each Apache-2.0 license file of the module.
+// Nothing is returned when none of the licenses is Apache-2.0.
+func noticeFiles(info GoModuleInfo, matches []LicenseMatch) []string {
+	dirs := make(map[string]struct{})
+	for _, m := range matches {
+		if !strings.HasPrefix(m.LicenseName, "Apache-") {
+			continue
+		}
+		dirs[info.Dir] = struct{}{}
+		// The license file of an override isn't in the module.
+		if dir := filepath.Dir(m.LicenseFile); dir == info.Dir || strings.HasPrefix(dir, info.Dir+string(filepath.Separator)) {
+			dirs[dir] = struct{}{}
+		}
+	}
+
+	var files []string
+	for dir := range dirs {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() && noticeFileRegex.MatchString(e.Name()) {
+				files = append(files, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// MissingNotice is the NOTICE file of an Apache-2.0 module that was found
+// but that the attribution template did not reproduce.
+type MissingNotice struct {
+	LibraryName    string
+	LibraryVersion string
+	NoticeFile     string
+}
+
+// MissingNotices returns the NOTICE files of the modules that the template
+// does not reproduce. The attribution is rendered again with each NOTICE
+// text replaced by a marker of its own, so that a NOTICE only counts as
+// reproduced when the template renders it in the module's section, and
+// not when the same text, such as a copyright line or nothing at all,
+// appears elsewhere.
+func (a *Attribution) MissingNotices(tmpl AttributionTemplate) ([]MissingNotice, error) {
+	marked := *a
+	marked.Modules = make([]AttributedModule, len(a.Modules))
+	for i, m := range a.Modules {
+		m.Notices = append([]NoticeText{}, m.Notices...)
+		for j := range m.Notices {
+			m.Notices[j].Text = noticeMarker(i, j)
+		}
+		marked.Modules[i] = m
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, marked); err != nil {
+		return nil, fmt.Errorf("while rendering the attribution: %w", err)
+	}
+
+	var missing []MissingNotice
+	for i, m := range a.Modules {
+		for j, n := range m.Notices {
+			if strings.Contains(rendered.String(), noticeMarker(i, j)) {
+				continue
+			}
+			missing = append(missing, MissingNotice{
+				LibraryName:    m.LibraryName,
+				LibraryVersion: m.LibraryVersion,
+				NoticeFile:     filepath.Join(m.SourceDir, n.File),
+			})
+		}
+	}
+	return missing, nil
+}
+
+// noticeMarker is made of characters that no template escapes, and no
+// marker contains another.
+func noticeMarker(module, notice int) string {
+	return fmt.Sprintf("go-providence-checker-notice-%d-%d-end", module, notice)
+}
@@ -0,0 +1,62 @@
+package checker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkOffline makes sure that the source code of every module of the build
+// list is either in the module cache or in the root module's vendor
+// directory, since nothing can be downloaded with --offline. It replaces
+// 'go mod download', which would stop at the first missing module.
+func (s *State) checkOffline() error {
+	s.Log.Info("looking for the transitive dependencies in the module cache")
+	modules, err := s.GoDownloadAll()
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, m := range modules {
+		if m.Error == "" {
+			continue
+		}
+		if _, found := s.vendored[m.Path+"@"+m.Version]; found {
+			continue
+		}
+		missing = append(missing, fmt.Sprintf("%s@%s: %s", m.Path, m.Version, strings.TrimSpace(m.Error)))
+	}
+	return missingModulesError(missing)
+}
+
+func missingModulesError(missing []string) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the following modules are neither in the module cache nor in the vendor directory, and --offline prevents downloading them:\n  %s", strings.Join(missing, "\n  "))
+}
+
+// useVendored sets the Dir of the modules that are missing from the module
+// cache to their directory in the vendor directory, if any.
+func (s *State) useVendored(modules []GoModuleInfo) {
+	dirs := make(map[string]struct{})
+	for _, dir := range s.vendored {
+		dirs[dir] = struct{}{}
+	}
+	for i, m := range modules {
+		src := source(m)
+		if src.Dir != "" || src.Version == "" {
+			continue
+		}
+		dir, found := s.vendored[src.Path+"@"+src.Version]
+		if !found {
+			continue
+		}
+		s.Log.Debugf("module %s@%s: using the vendored source code in '%s'", src.Path, src.Version, dir)
+		modules[i].Dir = dir
+		modules[i].VendorDirs = dirs
+		if m.Replace != nil {
+			modules[i].Replace.Dir = dir
+		}
+	}
+}
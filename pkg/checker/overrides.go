@@ -0,0 +1,176 @@
+package checker
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/jakexks/go-providence-checker/pkg/dirutil"
+	"github.com/spf13/viper"
+	"golang.org/x/mod/semver"
+)
+
+// DetectorManual is the detector of the licenses that were manually
+// asserted in the overrides file.
+const DetectorManual = "manual"
+
+// Override asserts the license of a module that can't be detected or is
+// misdetected. The overrides file looks like:
+//
+//	overrides:
+//	  - module: github.com/gogo/protobuf@v1.3.2
+//	    license: BSD-3-Clause
+//	    licenseFile: overrides/gogo-protobuf.txt
+//	  - module: github.com/example/bespoke
+//	    versions: ">=v1.2.0 <v1.4.0"
+//	    license: MIT
+//	    type: notice
+//	    licenseFile: overrides/bespoke.txt
+//
+// The module is either of the form "path@version" or just "path", in which
+// case the optional versions range applies. The licenseFile is relative to
+// the overrides file. The type is guessed from the license when empty.
+type Override struct {
+	Module      string `mapstructure:"module"`
+	Versions    string `mapstructure:"versions"`
+	License     string `mapstructure:"license"`
+	Type        string `mapstructure:"type"`
+	LicenseFile string `mapstructure:"licenseFile"`
+}
+
+// LoadOverrides reads the overrides file. The format is guessed from the
+// file extension.
+func LoadOverrides(path string) ([]Override, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading the overrides file '%s': %w", path, err)
+	}
+
+	var file struct {
+		Overrides []Override `mapstructure:"overrides"`
+	}
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, fmt.Errorf("parsing the overrides file '%s': %w", path, err)
+	}
+
+	for i, o := range file.Overrides {
+		switch {
+		case o.Module == "":
+			return nil, fmt.Errorf("overrides file '%s': an override is missing the 'module' field", path)
+		case o.License == "":
+			return nil, fmt.Errorf("overrides file '%s': the override for %s is missing the 'license' field", path, o.Module)
+		case o.LicenseFile == "":
+			return nil, fmt.Errorf("overrides file '%s': the override for %s is missing the 'licenseFile' field", path, o.Module)
+		case strings.Contains(o.LicenseFile, "://"):
+			return nil, fmt.Errorf("overrides file '%s': the override for %s must point to a local licenseFile, not to the URL '%s'", path, o.Module, o.LicenseFile)
+		case strings.Contains(o.Module, "@") && o.Versions != "":
+			return nil, fmt.Errorf("overrides file '%s': the override for %s cannot have both a version and a versions range", path, o.Module)
+		}
+		if o.Versions != "" {
+			if _, err := versionInRange("v0.0.0", o.Versions); err != nil {
+				return nil, fmt.Errorf("overrides file '%s': the override for %s: %w", path, o.Module, err)
+			}
+		}
+
+		if !filepath.IsAbs(o.LicenseFile) {
+			o.LicenseFile = filepath.Join(filepath.Dir(path), o.LicenseFile)
+		}
+		o.LicenseFile, _ = filepath.Abs(o.LicenseFile)
+		if !dirutil.Exists(o.LicenseFile) {
+			return nil, fmt.Errorf("overrides file '%s': the license file '%s' of the override for %s does not exist", path, o.LicenseFile, o.Module)
+		}
+		file.Overrides[i] = o
+	}
+
+	return file.Overrides, nil
+}
+
+// findOverride returns the first override that applies to the module.
+func findOverride(overrides []Override, info GoModuleInfo) (Override, bool) {
+	for _, o := range overrides {
+		if o.Module == info.Path+"@"+info.Version {
+			return o, true
+		}
+		if o.Module != info.Path {
+			continue
+		}
+		if o.Versions == "" {
+			return o, true
+		}
+		// The main module and the local replacements have no version.
+		if info.Version == "" {
+			continue
+		}
+		if ok, err := versionInRange(info.Version, o.Versions); err == nil && ok {
+			return o, true
+		}
+	}
+	return Override{}, false
+}
+
+func overrideLicenseInfo(info GoModuleInfo, o Override) LicenseInfo {
+	li := newLicenseInfo(info, []candidate{{license: o.License, confidence: 1, path: o.LicenseFile}}, nil, 1, DetectorManual)
+	li.LinkToLicense = ""
+	li.ManuallyAsserted = true
+	li.LicenseType = o.Type
+	if li.LicenseType == "" {
+		li.LicenseType = spdxExpressionType(o.License)
+	}
+	li.Licenses = []LicenseMatch{{
+		LicenseName: li.LicenseName,
+		LicenseType: li.LicenseType,
+		LicenseFile: li.LicenseFile,
+		Confidence:  1,
+		Dir:         ".",
+	}}
+	for _, p := range info.Packages {
+		li.Licenses[0].Packages = append(li.Licenses[0].Packages, p.ImportPath)
+	}
+	return li
+}
+
+// versionInRange returns true when the version satisfies every constraint
+// of the range, e.g. ">=v1.2.0 <v1.4.0". The operators are >=, >, <=, <
+// and =. The versions are compared as semantic versions, which includes
+// the pseudo-versions and the shorthands such as "v1.2".
+func versionInRange(v, constraints string) (bool, error) {
+	if !semver.IsValid(v) {
+		return false, fmt.Errorf("invalid version '%s'", v)
+	}
+	for _, constraint := range strings.Fields(constraints) {
+		var op string
+		for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(constraint, candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return false, fmt.Errorf("invalid version constraint '%s': expected one of the operators >=, >, <=, < or =", constraint)
+		}
+		bound := strings.TrimPrefix(constraint, op)
+		if !semver.IsValid(bound) {
+			return false, fmt.Errorf("invalid version constraint '%s': invalid version '%s'", constraint, bound)
+		}
+
+		c := semver.Compare(v, bound)
+		var ok bool
+		switch op {
+		case ">=":
+			ok = c >= 0
+		case ">":
+			ok = c > 0
+		case "<=":
+			ok = c <= 0
+		case "<":
+			ok = c < 0
+		case "=":
+			ok = c == 0
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
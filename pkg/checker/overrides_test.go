@@ -0,0 +1,135 @@
+package checker
+
+import (
+	"testing"
+)
+
+func TestVersionInRange(t *testing.T) {
+	tests := []struct {
+		version     string
+		constraints string
+		want        bool
+		wantErr     bool
+	}{
+		{version: "v1.3.0", constraints: ">=v1.2.0 <v1.4.0", want: true},
+		{version: "v1.2.0", constraints: ">=v1.2.0 <v1.4.0", want: true},
+		{version: "v1.4.0", constraints: ">=v1.2.0 <v1.4.0", want: false},
+		{version: "v1.1.9", constraints: ">=v1.2.0 <v1.4.0", want: false},
+		{version: "v1.2.0", constraints: ">v1.2.0", want: false},
+		{version: "v1.2.1", constraints: ">v1.2.0", want: true},
+		{version: "v1.2.0", constraints: "<=v1.2.0", want: true},
+		{version: "v1.2.0", constraints: "=v1.2.0", want: true},
+		{version: "v1.2.1", constraints: "=v1.2.0", want: false},
+		{version: "v1.2.0", constraints: "", want: true},
+
+		// Shorthands, prereleases, pseudo-versions and build metadata.
+		{version: "v1.2.0", constraints: "=v1.2", want: true},
+		{version: "v1.3.5", constraints: "<v2", want: true},
+		{version: "v1.2.0-rc.1", constraints: "<v1.2.0", want: true},
+		{version: "v1.2.0-rc.10", constraints: ">v1.2.0-rc.9", want: true},
+		{version: "v0.0.0-20200101000000-abcdefabcdef", constraints: "<v0.1.0", want: true},
+		{version: "v1.2.4-0.20200101000000-abcdefabcdef", constraints: ">v1.2.3 <v1.2.4", want: true},
+		{version: "v1.2.0+incompatible", constraints: "=v1.2.0", want: true},
+		{version: "v2.0.0+incompatible", constraints: ">=v2.0.0", want: true},
+
+		{version: "1.2.0", constraints: ">=v1.0.0", wantErr: true},
+		{version: "v1.2.0", constraints: ">=1.0.0", wantErr: true},
+		{version: "v1.2.0", constraints: "~v1.0.0", wantErr: true},
+		{version: "v1.2.0", constraints: ">=", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version+" "+tt.constraints, func(t *testing.T) {
+			got, err := versionInRange(tt.version, tt.constraints)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("versionInRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("versionInRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindOverride(t *testing.T) {
+	overrides := []Override{
+		{Module: "github.com/foo/bar@v1.0.0", License: "MIT"},
+		{Module: "github.com/foo/bar", Versions: ">=v1.2.0 <v1.4.0", License: "Apache-2.0"},
+		{Module: "github.com/foo/bar", License: "BSD-3-Clause"},
+		{Module: "github.com/foo/ranged", Versions: ">=v1.2.0", License: "ISC"},
+	}
+	tests := []struct {
+		name        string
+		info        GoModuleInfo
+		wantLicense string
+		wantFound   bool
+	}{
+		{name: "exact version", info: GoModuleInfo{Path: "github.com/foo/bar", Version: "v1.0.0"}, wantLicense: "MIT", wantFound: true},
+		{name: "in range", info: GoModuleInfo{Path: "github.com/foo/bar", Version: "v1.3.0"}, wantLicense: "Apache-2.0", wantFound: true},
+		{name: "any version", info: GoModuleInfo{Path: "github.com/foo/bar", Version: "v1.4.0"}, wantLicense: "BSD-3-Clause", wantFound: true},
+		{name: "out of range", info: GoModuleInfo{Path: "github.com/foo/ranged", Version: "v1.1.0"}},
+		{name: "no version", info: GoModuleInfo{Path: "github.com/foo/ranged"}},
+		{name: "other module", info: GoModuleInfo{Path: "github.com/foo/baz", Version: "v1.0.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, found := findOverride(overrides, tt.info)
+			if found != tt.wantFound {
+				t.Fatalf("findOverride() found = %v, want %v", found, tt.wantFound)
+			}
+			if o.License != tt.wantLicense {
+				t.Errorf("findOverride() license = %s, want %s", o.License, tt.wantLicense)
+			}
+		})
+	}
+}
+
+func TestSPDXExpressionType(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "MIT", want: "notice"},
+		{expr: "GPL-3.0-only", want: "restricted"},
+		{expr: "MIT OR GPL-3.0-only", want: "notice"},
+		{expr: "MIT AND GPL-3.0-only", want: "restricted"},
+		{expr: "Apache-2.0 AND (MIT OR GPL-3.0-only)", want: "notice"},
+		{expr: "(MIT OR GPL-3.0-only) AND MPL-2.0", want: "reciprocal"},
+		{expr: "GPL-2.0-only WITH Classpath-exception-2.0 OR MIT", want: "notice"},
+
+		// Malformed expressions are assumed to be restricted.
+		{expr: "", want: "restricted"},
+		{expr: "MIT OR", want: "restricted"},
+		{expr: "(MIT", want: "restricted"},
+		{expr: "MIT Apache-2.0", want: "restricted"},
+		{expr: "MIT WITH", want: "restricted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if got := spdxExpressionType(tt.expr); got != tt.want {
+				t.Errorf("spdxExpressionType(%q) = %s, want %s", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverrideLicenseInfoType(t *testing.T) {
+	tests := []struct {
+		name     string
+		override Override
+		want     string
+	}{
+		{name: "guessed from the expression", override: Override{License: "MIT OR GPL-3.0-only"}, want: "notice"},
+		{name: "given", override: Override{License: "LicenseRef-Bespoke", Type: "permissive"}, want: "permissive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			li := overrideLicenseInfo(GoModuleInfo{Path: "github.com/foo/bar", Version: "v1.0.0"}, tt.override)
+			if li.LicenseType != tt.want {
+				t.Errorf("overrideLicenseInfo() type = %s, want %s", li.LicenseType, tt.want)
+			}
+			if len(li.Licenses) != 1 || li.Licenses[0].LicenseType != tt.want {
+				t.Errorf("overrideLicenseInfo() licenses = %+v, want a single license of type %s", li.Licenses, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package checker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// GoPackageInfo is a package as returned by 'go list -deps -json'.
+type GoPackageInfo struct {
+	ImportPath string        `json:"ImportPath"`
+	Name       string        `json:"Name"`
+	Dir        string        `json:"Dir"`
+	Standard   bool          `json:"Standard"`
+	DepOnly    bool          `json:"DepOnly"`
+	Module     *GoModuleInfo `json:"Module"`
+
+	// Error is set when the package could not be loaded, and DepsErrors
+	// when one of its dependencies could not be loaded.
+	Error      *GoPackageError   `json:"Error"`
+	DepsErrors []*GoPackageError `json:"DepsErrors"`
+}
+
+// GoPackageError is an error loading a package, as given by 'go list -e'.
+type GoPackageError struct {
+	ImportStack []string `json:"ImportStack"`
+	Pos         string   `json:"Pos"`
+	Err         string   `json:"Err"`
+}
+
+func (e GoPackageError) String() string {
+	if e.Pos != "" {
+		return e.Pos + ": " + e.Err
+	}
+	return e.Err
+}
+
+// GoListPackages returns the packages matched by the patterns as well as
+// all their dependencies, excluding the standard library. The patterns
+// default to "./...", i.e., every package of the root module, or to every
+// package of the modules of the workspace. The target platform and build
+// tags given to Init are honored, and the test-only dependencies are left
+// out. An error is returned when a package can't be loaded, since the
+// module that provides it would be missing, unless --force is given.
+func (s *State) GoListPackages(patterns ...string) ([]GoPackageInfo, error) {
+	if len(patterns) == 0 && s.workFile != "" {
+		for _, m := range s.workspace {
+			patterns = append(patterns, m.Path+"/...")
+		}
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	args := []string{"list", "-e", "-deps", "-json"}
+	if s.tags != "" {
+		args = append(args, "-tags", s.tags)
+	}
+	args = append(args, patterns...)
+	cmd := s.buildCmd("go", args...)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("while running 'go %v': %w", args, err)
+	}
+
+	var pkgs []GoPackageInfo
+	var loadErrors []string
+	seen := make(map[string]struct{})
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var p GoPackageInfo
+		if err := dec.Decode(&p); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("parsing the output of 'go %v': %w", args, err)
+		}
+		// A package that can't be found has no module, so the errors are
+		// looked at first.
+		for _, e := range append([]*GoPackageError{p.Error}, p.DepsErrors...) {
+			if e == nil {
+				continue
+			}
+			if _, found := seen[e.String()]; !found {
+				seen[e.String()] = struct{}{}
+				loadErrors = append(loadErrors, e.String())
+			}
+		}
+		if p.Standard || p.Module == nil {
+			continue
+		}
+		pkgs = append(pkgs, p)
+	}
+
+	if len(loadErrors) > 0 {
+		msg := fmt.Sprintf("the following packages could not be loaded, so the modules that provide them may be missing:\n  %s", strings.Join(loadErrors, "\n  "))
+		if !viper.GetBool("force") {
+			return nil, fmt.Errorf("%s\nRun with --force to ignore.", msg)
+		}
+		s.Log.Infof("%s", msg)
+	}
+
+	return pkgs, nil
+}
+
+// WithPackages sets the Packages of each module and only keeps the modules
+// that provide at least one of the packages. The main module is always
+// kept.
+func WithPackages(modules []GoModuleInfo, pkgs []GoPackageInfo) []GoModuleInfo {
+	byModule := make(map[string][]GoPackageInfo)
+	for _, p := range pkgs {
+		byModule[p.Module.Path] = append(byModule[p.Module.Path], p)
+	}
+
+	var kept []GoModuleInfo
+	for _, m := range Shipped(modules, pkgs) {
+		m.Packages = byModule[m.Path]
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// Shipped only keeps the modules that provide at least one of the
+// packages, i.e., the modules that are linked into the binaries. The main
+// module is always kept.
+func Shipped(modules []GoModuleInfo, pkgs []GoPackageInfo) []GoModuleInfo {
+	provided := make(map[string]struct{})
+	for _, p := range pkgs {
+		provided[p.Module.Path] = struct{}{}
+	}
+
+	var kept []GoModuleInfo
+	for _, m := range modules {
+		if _, found := provided[m.Path]; !found && !m.Main {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// CheckMainPackages returns an error when one of the packages matched by
+// the patterns given to GoListPackages isn't a main package.
+func CheckMainPackages(pkgs []GoPackageInfo) error {
+	var notMain []string
+	for _, p := range pkgs {
+		if !p.DepOnly && p.Name != "main" {
+			notMain = append(notMain, p.ImportPath)
+		}
+	}
+	if len(notMain) > 0 {
+		return fmt.Errorf("the following packages are not main packages: %s", strings.Join(notMain, ", "))
+	}
+	return nil
+}
+
+// governingCandidates only keeps the license files that govern the
+// packages of the module. A package is governed by the license files found
+// in the deepest directory between the package's directory and the
+// module's root that contains license files. It also returns the import
+// paths of the packages governed by each directory. The candidates are
+// returned as-is when the packages of the module are unknown.
+func governingCandidates(info GoModuleInfo, candidates []candidate) ([]candidate, map[string][]string) {
+	if len(info.Packages) == 0 {
+		return candidates, nil
+	}
+
+	licenseDirs := make(map[string]struct{})
+	for _, c := range candidates {
+		licenseDirs[filepath.Dir(c.path)] = struct{}{}
+	}
+
+	governed := make(map[string][]string)
+	for _, p := range info.Packages {
+		dir := p.Dir
+		for {
+			if _, found := licenseDirs[dir]; found {
+				governed[dir] = append(governed[dir], p.ImportPath)
+				break
+			}
+			if dir == info.Dir || !strings.HasPrefix(dir, info.Dir+string(filepath.Separator)) {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+	for _, pkgs := range governed {
+		sort.Strings(pkgs)
+	}
+
+	var kept []candidate
+	for _, c := range candidates {
+		if _, found := governed[filepath.Dir(c.path)]; found {
+			kept = append(kept, c)
+		}
+	}
+	return kept, governed
+}
@@ -0,0 +1,167 @@
+package checker
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGoverningCandidates(t *testing.T) {
+	root := filepath.FromSlash("/mod")
+	path := func(rel string) string {
+		return filepath.Join(root, filepath.FromSlash(rel))
+	}
+	pkg := func(importPath, rel string) GoPackageInfo {
+		return GoPackageInfo{ImportPath: importPath, Dir: path(rel)}
+	}
+	candidates := []candidate{
+		{license: "MIT", path: path("LICENSE")},
+		{license: "BSD-3-Clause", path: path("third_party/forked/LICENSE")},
+		{license: "GPL-3.0", path: path("examples/LICENSE")},
+	}
+
+	tests := []struct {
+		name         string
+		packages     []GoPackageInfo
+		wantLicenses []string
+		wantGoverned map[string][]string
+	}{
+		{
+			name:         "packages unknown",
+			wantLicenses: []string{"MIT", "BSD-3-Clause", "GPL-3.0"},
+		},
+		{
+			name:         "package at the root",
+			packages:     []GoPackageInfo{pkg("example.com/mod", ".")},
+			wantLicenses: []string{"MIT"},
+			wantGoverned: map[string][]string{root: {"example.com/mod"}},
+		},
+		{
+			name:         "package governed by the closest license",
+			packages:     []GoPackageInfo{pkg("example.com/mod/third_party/forked/deep", "third_party/forked/deep"), pkg("example.com/mod/util", "util")},
+			wantLicenses: []string{"MIT", "BSD-3-Clause"},
+			wantGoverned: map[string][]string{
+				root:                       {"example.com/mod/util"},
+				path("third_party/forked"): {"example.com/mod/third_party/forked/deep"},
+			},
+		},
+		{
+			name:         "only the package with a license of its own",
+			packages:     []GoPackageInfo{pkg("example.com/mod/examples", "examples")},
+			wantLicenses: []string{"GPL-3.0"},
+			wantGoverned: map[string][]string{path("examples"): {"example.com/mod/examples"}},
+		},
+		{
+			name:         "packages sorted",
+			packages:     []GoPackageInfo{pkg("example.com/mod/b", "b"), pkg("example.com/mod/a", "a")},
+			wantLicenses: []string{"MIT"},
+			wantGoverned: map[string][]string{root: {"example.com/mod/a", "example.com/mod/b"}},
+		},
+		{
+			name:     "package outside of the module",
+			packages: []GoPackageInfo{{ImportPath: "example.com/other", Dir: filepath.FromSlash("/other")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, governed := governingCandidates(GoModuleInfo{Path: "example.com/mod", Dir: root, Packages: tt.packages}, candidates)
+			var licenses []string
+			for _, c := range kept {
+				licenses = append(licenses, c.license)
+			}
+			if !reflect.DeepEqual(licenses, tt.wantLicenses) {
+				t.Errorf("governingCandidates() licenses = %v, want %v", licenses, tt.wantLicenses)
+			}
+			if len(governed) == 0 && len(tt.wantGoverned) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(governed, tt.wantGoverned) {
+				t.Errorf("governingCandidates() governed = %v, want %v", governed, tt.wantGoverned)
+			}
+		})
+	}
+}
+
+func TestWithPackages(t *testing.T) {
+	main := GoModuleInfo{Path: "example.com/main", Main: true}
+	used := GoModuleInfo{Path: "example.com/used", Version: "v1.0.0"}
+	unused := GoModuleInfo{Path: "example.com/unused", Version: "v1.0.0"}
+	pkgs := []GoPackageInfo{
+		{ImportPath: "example.com/used/a", Module: &used},
+		{ImportPath: "example.com/used/b", Module: &used},
+	}
+
+	got := WithPackages([]GoModuleInfo{main, used, unused}, pkgs)
+	var paths []string
+	for _, m := range got {
+		paths = append(paths, m.Path)
+	}
+	if want := []string{"example.com/main", "example.com/used"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("WithPackages() modules = %v, want %v", paths, want)
+	}
+	if len(got[0].Packages) != 0 {
+		t.Errorf("WithPackages() packages of the main module = %v, want none", got[0].Packages)
+	}
+	if !reflect.DeepEqual(got[1].Packages, pkgs) {
+		t.Errorf("WithPackages() packages = %v, want %v", got[1].Packages, pkgs)
+	}
+}
+
+func TestFastClassifyWithPackages(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "LICENSE"), readTestLicense(t, "MIT"))
+	writeTestFile(t, filepath.Join(dir, "lib.go"), "package lib\n")
+	writeTestFile(t, filepath.Join(dir, "examples", "LICENSE"), readTestLicense(t, "MPL-2.0"))
+	writeTestFile(t, filepath.Join(dir, "examples", "main.go"), "package main\n")
+	writeTestFile(t, filepath.Join(dir, "third_party", "forked", "LICENSE"), readTestLicense(t, "BSD-3-Clause"))
+	writeTestFile(t, filepath.Join(dir, "third_party", "forked", "forked.go"), "package forked\n")
+
+	tests := []struct {
+		name         string
+		packages     []GoPackageInfo
+		wantLicense  string
+		wantType     string
+		wantPackages map[string][]string
+	}{
+		{
+			name:        "whole module",
+			wantLicense: "MIT AND BSD-3-Clause AND MPL-2.0",
+			wantType:    "reciprocal",
+		},
+		{
+			name:         "examples not imported",
+			packages:     []GoPackageInfo{{ImportPath: "example.com/lib", Dir: dir}, {ImportPath: "example.com/lib/third_party/forked", Dir: filepath.Join(dir, "third_party", "forked")}},
+			wantLicense:  "MIT AND BSD-3-Clause",
+			wantType:     "notice",
+			wantPackages: map[string][]string{"MIT": {"example.com/lib"}, "BSD-3-Clause": {"example.com/lib/third_party/forked"}},
+		},
+		{
+			name:         "examples imported",
+			packages:     []GoPackageInfo{{ImportPath: "example.com/lib/examples", Dir: filepath.Join(dir, "examples")}},
+			wantLicense:  "MPL-2.0",
+			wantType:     "reciprocal",
+			wantPackages: map[string][]string{"MPL-2.0": {"example.com/lib/examples"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			li, err := fastClassify(GoModuleInfo{Path: "example.com/lib", Version: "v1.0.0", Dir: dir, Packages: tt.packages}, 0.9, nil)
+			if err != nil {
+				t.Fatalf("fastClassify() error = %v", err)
+			}
+			if li.LicenseName != tt.wantLicense || li.LicenseType != tt.wantType {
+				t.Errorf("fastClassify() = %s (%s), want %s (%s)", li.LicenseName, li.LicenseType, tt.wantLicense, tt.wantType)
+			}
+			if tt.wantPackages == nil {
+				return
+			}
+			packages := make(map[string][]string)
+			for _, m := range li.Licenses {
+				packages[m.LicenseName] = m.Packages
+			}
+			if !reflect.DeepEqual(packages, tt.wantPackages) {
+				t.Errorf("fastClassify() packages = %v, want %v", packages, tt.wantPackages)
+			}
+		})
+	}
+}
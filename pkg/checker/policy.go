@@ -0,0 +1,219 @@
+package checker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Policy decides which licenses are acceptable. It is loaded from a YAML or
+// JSON file such as:
+//
+//	allow:
+//	  types: [notice, permissive, unencumbered]
+//	deny:
+//	  licenses: [AGPL-3.0]
+//	  types: [forbidden]
+//	review:
+//	  types: [reciprocal, restricted]
+//	exceptions:
+//	  - module: github.com/hashicorp/golang-lru@v0.5.4
+//	    justification: reviewed by legal, see LEGAL-42
+//	    expires: 2022-01-01
+//
+// A rule on a license id takes precedence over a rule on a license type.
+// A license that isn't listed anywhere is denied. When a module has several
+// licenses, it is enough for one of the dual licenses at its root to be
+// allowed, but every license that applies in addition must be allowed.
+type Policy struct {
+	Allow      PolicyRule        `mapstructure:"allow"`
+	Deny       PolicyRule        `mapstructure:"deny"`
+	Review     PolicyRule        `mapstructure:"review"`
+	Exceptions []PolicyException `mapstructure:"exceptions"`
+}
+
+type PolicyRule struct {
+	// Licenses are SPDX ids such as "MIT".
+	Licenses []string `mapstructure:"licenses"`
+	// Types are the license types such as "notice" or "restricted".
+	Types []string `mapstructure:"types"`
+}
+
+// PolicyException allows a module regardless of its license until the
+// expiry date. The module is either of the form "path@version", in which
+// case only this version is allowed, or just "path".
+type PolicyException struct {
+	Module        string `mapstructure:"module"`
+	Justification string `mapstructure:"justification"`
+	// Expires is of the form "2006-01-02". The exception never expires
+	// when empty.
+	Expires string `mapstructure:"expires"`
+}
+
+// The decisions returned by Policy.Evaluate.
+const (
+	PolicyAllowed     = "allowed"
+	PolicyDenied      = "denied"
+	PolicyNeedsReview = "needs-review"
+)
+
+// PolicyViolation is a module whose license is either denied or needs to be
+// reviewed.
+type PolicyViolation struct {
+	LibraryName    string
+	LibraryVersion string
+	LicenseName    string
+	LicenseType    string
+	Decision       string
+	Reason         string
+}
+
+func (v PolicyViolation) String() string {
+	return fmt.Sprintf("module %s@%s: %s (%s) %s: %s", v.LibraryName, v.LibraryVersion, v.LicenseName, v.LicenseType, v.Decision, v.Reason)
+}
+
+// LoadPolicy reads the policy file. The format is guessed from the file
+// extension.
+func LoadPolicy(path string) (*Policy, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading the policy file '%s': %w", path, err)
+	}
+
+	var p Policy
+	if err := v.Unmarshal(&p); err != nil {
+		return nil, fmt.Errorf("parsing the policy file '%s': %w", path, err)
+	}
+	for _, e := range p.Exceptions {
+		if e.Module == "" {
+			return nil, fmt.Errorf("policy file '%s': an exception is missing the 'module' field", path)
+		}
+		if e.Justification == "" {
+			return nil, fmt.Errorf("policy file '%s': the exception for %s is missing a justification", path, e.Module)
+		}
+		if e.Expires == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", e.Expires); err != nil {
+			return nil, fmt.Errorf("policy file '%s': the exception for %s has an invalid expiry date '%s', expected YYYY-MM-DD", path, e.Module, e.Expires)
+		}
+	}
+
+	return &p, nil
+}
+
+// Evaluate returns nil when the license of the module is allowed at the
+// given time.
+func (p *Policy) Evaluate(li LicenseInfo, now time.Time) *PolicyViolation {
+	decision, reason := p.decide(li, now)
+	if decision == PolicyAllowed {
+		return nil
+	}
+	return &PolicyViolation{
+		LibraryName:    li.LibraryName,
+		LibraryVersion: li.LibraryVersion,
+		LicenseName:    li.LicenseName,
+		LicenseType:    li.LicenseType,
+		Decision:       decision,
+		Reason:         reason,
+	}
+}
+
+func (p *Policy) decide(li LicenseInfo, now time.Time) (decision, reason string) {
+	var expired []string
+	for _, e := range p.Exceptions {
+		if e.Module != li.LibraryName && e.Module != li.LibraryName+"@"+li.LibraryVersion {
+			continue
+		}
+		if e.Expires != "" {
+			expires, _ := time.Parse("2006-01-02", e.Expires)
+			if !now.Before(expires.AddDate(0, 0, 1)) {
+				expired = append(expired, e.Expires)
+				continue
+			}
+		}
+		return PolicyAllowed, "exception: " + e.Justification
+	}
+
+	suffix := ""
+	if len(expired) > 0 {
+		suffix = fmt.Sprintf(" (the exception expired on %s)", strings.Join(expired, ", "))
+	}
+
+	matches := li.Licenses
+	if len(matches) == 0 {
+		matches = []LicenseMatch{{LicenseName: li.LicenseName, LicenseType: li.LicenseType, Dir: "."}}
+	}
+
+	// The licenses at the root of the module are alternatives when they
+	// are dual licenses, as in the report, so the most favorable decision
+	// among them is kept. The other licenses apply in addition, so the
+	// least favorable decision wins.
+	alternatives := dualLicensed(matches)
+	for _, m := range matches {
+		if m.Dir != "." || !alternatives {
+			continue
+		}
+		d, r := p.decideLicense(m.LicenseName, m.LicenseType)
+		if decision == "" || decisionRank(d) < decisionRank(decision) {
+			decision, reason = d, r
+		}
+	}
+	for _, m := range matches {
+		if m.Dir == "." && alternatives {
+			continue
+		}
+		d, r := p.decideLicense(m.LicenseName, m.LicenseType)
+		if m.Dir != "." {
+			r = fmt.Sprintf("%s in %s", r, m.Dir)
+		}
+		if decision == "" || decisionRank(d) > decisionRank(decision) {
+			decision, reason = d, r
+		}
+	}
+
+	if decision != PolicyAllowed {
+		reason += suffix
+	}
+	return decision, reason
+}
+
+func (p *Policy) decideLicense(name, licenseType string) (decision, reason string) {
+	switch {
+	case contains(p.Deny.Licenses, name):
+		return PolicyDenied, fmt.Sprintf("the license %s is in the deny list", name)
+	case contains(p.Allow.Licenses, name):
+		return PolicyAllowed, fmt.Sprintf("the license %s is in the allow list", name)
+	case contains(p.Review.Licenses, name):
+		return PolicyNeedsReview, fmt.Sprintf("the license %s is in the review list", name)
+	case contains(p.Deny.Types, licenseType):
+		return PolicyDenied, fmt.Sprintf("the license type %s of %s is in the deny list", licenseType, name)
+	case contains(p.Allow.Types, licenseType):
+		return PolicyAllowed, fmt.Sprintf("the license type %s of %s is in the allow list", licenseType, name)
+	case contains(p.Review.Types, licenseType):
+		return PolicyNeedsReview, fmt.Sprintf("the license type %s of %s is in the review list", licenseType, name)
+	}
+	return PolicyDenied, fmt.Sprintf("neither the license %s nor its type %s is listed in the policy", name, licenseType)
+}
+
+func decisionRank(decision string) int {
+	switch decision {
+	case PolicyAllowed:
+		return 0
+	case PolicyNeedsReview:
+		return 1
+	}
+	return 2
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package checker
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "yaml",
+			file: "policy.yaml",
+			content: `allow:
+  types: [notice]
+deny:
+  licenses: [AGPL-3.0]
+review:
+  types: [reciprocal]
+exceptions:
+  - module: github.com/foo/bar@v1.0.0
+    justification: reviewed
+    expires: 2022-01-01
+  - module: github.com/foo/baz
+    justification: reviewed
+`,
+		},
+		{
+			name:    "json",
+			file:    "policy.json",
+			content: `{"allow": {"licenses": ["MIT"]}, "exceptions": [{"module": "github.com/foo/bar", "justification": "reviewed"}]}`,
+		},
+		{
+			name:    "exception without module",
+			file:    "policy.yaml",
+			content: "exceptions:\n  - justification: reviewed\n",
+			wantErr: "an exception is missing the 'module' field",
+		},
+		{
+			name:    "exception without justification",
+			file:    "policy.yaml",
+			content: "exceptions:\n  - module: github.com/foo/bar\n",
+			wantErr: "the exception for github.com/foo/bar is missing a justification",
+		},
+		{
+			name:    "invalid expiry date",
+			file:    "policy.yaml",
+			content: "exceptions:\n  - module: github.com/foo/bar\n    justification: reviewed\n    expires: 01/01/2022\n",
+			wantErr: "invalid expiry date '01/01/2022'",
+		},
+		{
+			name:    "invalid yaml",
+			file:    "policy.yaml",
+			content: "allow: [",
+			wantErr: "reading the policy file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			writeTestFile(t, path, tt.content)
+
+			p, err := LoadPolicy(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadPolicy() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadPolicy() error = %v", err)
+			}
+			if len(p.Exceptions) == 0 {
+				t.Errorf("LoadPolicy() = %+v, want the exceptions to be loaded", p)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy := &Policy{
+		Allow:  PolicyRule{Licenses: []string{"LGPL-3.0"}, Types: []string{"notice", "permissive"}},
+		Deny:   PolicyRule{Licenses: []string{"BSD-4-Clause"}, Types: []string{"forbidden"}},
+		Review: PolicyRule{Types: []string{"reciprocal", "restricted"}},
+		Exceptions: []PolicyException{
+			{Module: "github.com/foo/excepted@v1.0.0", Justification: "reviewed by legal"},
+			{Module: "github.com/foo/expiring", Justification: "reviewed by legal", Expires: "2022-01-01"},
+		},
+	}
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	module := func(path, version string, matches ...LicenseMatch) LicenseInfo {
+		li := LicenseInfo{LibraryName: path, LibraryVersion: version, Licenses: matches}
+		if len(matches) > 0 {
+			li.LicenseName, li.LicenseType = matches[0].LicenseName, matches[0].LicenseType
+		}
+		return li
+	}
+	root := func(name, licenseType string) LicenseMatch {
+		return LicenseMatch{LicenseName: name, LicenseType: licenseType, Dir: "."}
+	}
+	rootFile := func(file, name, licenseType string) LicenseMatch {
+		return LicenseMatch{LicenseName: name, LicenseType: licenseType, LicenseFile: filepath.Join("/src", file), Dir: "."}
+	}
+
+	tests := []struct {
+		name         string
+		li           LicenseInfo
+		now          time.Time
+		wantDecision string
+		wantReason   string
+	}{
+		{
+			name:         "allowed type",
+			li:           module("github.com/foo/bar", "v1.0.0", root("MIT", "notice")),
+			wantDecision: PolicyAllowed,
+		},
+		{
+			name:         "license rule takes precedence over type rule",
+			li:           module("github.com/foo/bar", "v1.0.0", root("BSD-4-Clause", "notice")),
+			wantDecision: PolicyDenied,
+			wantReason:   "the license BSD-4-Clause is in the deny list",
+		},
+		{
+			name:         "allowed license of a type under review",
+			li:           module("github.com/foo/bar", "v1.0.0", root("LGPL-3.0", "restricted")),
+			wantDecision: PolicyAllowed,
+		},
+		{
+			name:         "type under review",
+			li:           module("github.com/foo/bar", "v1.0.0", root("MPL-2.0", "reciprocal")),
+			wantDecision: PolicyNeedsReview,
+			wantReason:   "the license type reciprocal of MPL-2.0 is in the review list",
+		},
+		{
+			name:         "unlisted type",
+			li:           module("github.com/foo/bar", "v1.0.0", root("Custom", "unknown")),
+			wantDecision: PolicyDenied,
+			wantReason:   "neither the license Custom nor its type unknown is listed in the policy",
+		},
+		{
+			name:         "no license matches",
+			li:           LicenseInfo{LibraryName: "github.com/foo/bar", LibraryVersion: "v1.0.0", LicenseName: "GPL-3.0", LicenseType: "restricted"},
+			wantDecision: PolicyNeedsReview,
+			wantReason:   "the license type restricted of GPL-3.0 is in the review list",
+		},
+		{
+			name:         "allowed dual license at the root",
+			li:           module("github.com/foo/bar", "v1.0.0", rootFile("LICENSE-GPL", "GPL-3.0", "restricted"), rootFile("LICENSE-MIT", "MIT", "notice")),
+			wantDecision: PolicyAllowed,
+		},
+		{
+			name:         "licenses at the root that all apply",
+			li:           module("github.com/foo/bar", "v1.0.0", rootFile("LICENSE", "MIT", "notice"), rootFile("COPYING", "GPL-3.0", "restricted")),
+			wantDecision: PolicyNeedsReview,
+			wantReason:   "the license type restricted of GPL-3.0 is in the review list",
+		},
+		{
+			name: "license of a subdirectory applies in addition",
+			li: module("github.com/foo/bar", "v1.0.0", root("MIT", "notice"),
+				LicenseMatch{LicenseName: "GPL-3.0", LicenseType: "restricted", Dir: "third_party/gpl"}),
+			wantDecision: PolicyNeedsReview,
+			wantReason:   "the license type restricted of GPL-3.0 is in the review list in third_party/gpl",
+		},
+		{
+			name: "least favorable subdirectory wins",
+			li: module("github.com/foo/bar", "v1.0.0", root("MIT", "notice"),
+				LicenseMatch{LicenseName: "MPL-2.0", LicenseType: "reciprocal", Dir: "a"},
+				LicenseMatch{LicenseName: "BSD-4-Clause", LicenseType: "notice", Dir: "b"}),
+			wantDecision: PolicyDenied,
+			wantReason:   "the license BSD-4-Clause is in the deny list in b",
+		},
+		{
+			name:         "exception for the version",
+			li:           module("github.com/foo/excepted", "v1.0.0", root("Custom", "forbidden")),
+			wantDecision: PolicyAllowed,
+		},
+		{
+			name:         "exception for another version",
+			li:           module("github.com/foo/excepted", "v1.1.0", root("Custom", "forbidden")),
+			wantDecision: PolicyDenied,
+			wantReason:   "the license type forbidden of Custom is in the deny list",
+		},
+		{
+			name:         "exception until the end of the expiry day",
+			li:           module("github.com/foo/expiring", "v1.0.0", root("Custom", "forbidden")),
+			wantDecision: PolicyAllowed,
+		},
+		{
+			name:         "expired exception",
+			li:           module("github.com/foo/expiring", "v1.0.0", root("Custom", "forbidden")),
+			now:          time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC),
+			wantDecision: PolicyDenied,
+			wantReason:   "the license type forbidden of Custom is in the deny list (the exception expired on 2022-01-01)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := now
+			if !tt.now.IsZero() {
+				at = tt.now
+			}
+			v := policy.Evaluate(tt.li, at)
+			if tt.wantDecision == PolicyAllowed {
+				if v != nil {
+					t.Errorf("Evaluate() = %v, want nil", v)
+				}
+				return
+			}
+			if v == nil {
+				t.Fatalf("Evaluate() = nil, want a %s violation", tt.wantDecision)
+			}
+			if v.Decision != tt.wantDecision || v.Reason != tt.wantReason {
+				t.Errorf("Evaluate() = %s: %s, want %s: %s", v.Decision, v.Reason, tt.wantDecision, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package checker
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Report is the machine-readable result of a run over all the dependencies
+// of the root modules.
+type Report struct {
+	Root       string
+	Modules    []LicenseInfo
+	Failures   []Failure
+	Violations []PolicyViolation
+
+	// MissingNotices are the NOTICE files of the Apache-2.0 modules that
+	// were found but that the license file does not reproduce.
+	MissingNotices []MissingNotice
+
+	// Roots gives the dependencies that each root module needs. It is only
+	// set when there are several root modules.
+	Roots map[string][]string `json:",omitempty"`
+}
+
+// NewReport returns an empty report. The slices are non-nil so that they
+// are encoded as empty JSON arrays rather than null.
+func NewReport(root string) *Report {
+	return &Report{Root: root, Modules: []LicenseInfo{}, Failures: []Failure{}, Violations: []PolicyViolation{}, MissingNotices: []MissingNotice{}}
+}
+
+// Failure is a module that could not be classified.
+type Failure struct {
+	LibraryName    string
+	LibraryVersion string
+	Reason         string
+}
+
+func (r *Report) AddFailure(info GoModuleInfo, reason string) {
+	r.Failures = append(r.Failures, Failure{
+		LibraryName:    info.Path,
+		LibraryVersion: info.Version,
+		Reason:         reason,
+	})
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
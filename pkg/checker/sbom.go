@@ -0,0 +1,97 @@
+package checker
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// SBOM holds what is needed to write a software bill of materials: every
+// module of the build list, the license of each module that could be
+// classified and the module graph.
+type SBOM struct {
+	Root    GoModuleInfo
+	Modules []GoModuleInfo
+
+	// Licenses is keyed by "path@version". A module that could not be
+	// classified has no entry.
+	Licenses map[string]LicenseInfo
+
+	// Graph is the output of GoModGraph.
+	Graph map[string][]string
+
+	// Custom are the custom licenses, whose texts are given along with
+	// their "LicenseRef-" ids.
+	Custom []CustomLicense
+}
+
+func NewSBOM(root GoModuleInfo) *SBOM {
+	return &SBOM{
+		Root:     root,
+		Licenses: make(map[string]LicenseInfo),
+		Graph:    make(map[string][]string),
+	}
+}
+
+// Add records a module of the build list. The license info is nil when
+// the module could not be classified.
+func (b *SBOM) Add(info GoModuleInfo, li *LicenseInfo) {
+	b.Modules = append(b.Modules, info)
+	if li != nil {
+		b.Licenses[modKey(info)] = *li
+	}
+}
+
+func modKey(info GoModuleInfo) string {
+	return ModuleVersion{Path: info.Path, Version: info.Version}.String()
+}
+
+// source returns the module whose content is actually built, i.e., the
+// replacement when the module is replaced.
+func source(info GoModuleInfo) GoModuleInfo {
+	if info.Replace != nil {
+		return *info.Replace
+	}
+	return info
+}
+
+// downloadLocation returns the URL of the module's zip on the Go module
+// proxy, or an empty string when the module has no version, which is the
+// case for the main module and for local replacements.
+func downloadLocation(info GoModuleInfo) string {
+	src := source(info)
+	if src.Version == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://proxy.golang.org/%s/@v/%s.zip", escapeModPath(src.Path), escapeModPath(src.Version))
+}
+
+// escapeModPath escapes upper-case letters the way the Go module proxy
+// expects, e.g. "github.com/Azure/go-autorest" becomes
+// "github.com/!azure/go-autorest".
+func escapeModPath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// purl returns the package URL of the module, e.g.
+// "pkg:golang/github.com/spf13/cobra@v1.1.1".
+func purl(info GoModuleInfo) string {
+	var segments []string
+	for _, segment := range strings.Split(info.Path, "/") {
+		segments = append(segments, url.PathEscape(segment))
+	}
+	p := "pkg:golang/" + strings.Join(segments, "/")
+	if info.Version != "" {
+		p += "@" + url.PathEscape(info.Version)
+	}
+	return p
+}
@@ -0,0 +1,325 @@
+package checker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const spdxNoAssertion = "NOASSERTION"
+
+var (
+	spdxInvalidIDChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+	spdxLicenseRef     = regexp.MustCompile(`^LicenseRef-[A-Za-z0-9.-]+$`)
+)
+
+// The SPDX 2.3 document, as described in
+// https://spdx.github.io/spdx-spec/v2.3/. The JSON tags follow the SPDX
+// JSON schema.
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	DocumentDescribes []string           `json:"documentDescribes"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+
+	// The licenses that are not on the SPDX license list, i.e. the custom
+	// licenses, must be declared with their text.
+	ExtractedLicensingInfos []spdxExtractedLicense `json:"hasExtractedLicensingInfos,omitempty"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	LicenseComments  string            `json:"licenseComments,omitempty"`
+	CopyrightText    string            `json:"copyrightText"`
+	Comment          string            `json:"comment,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxExtractedLicense struct {
+	LicenseID     string `json:"licenseId"`
+	ExtractedText string `json:"extractedText"`
+	Name          string `json:"name"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// WriteSPDXJSON writes the SBOM as an SPDX 2.3 JSON document.
+func (b *SBOM) WriteSPDXJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b.spdx())
+}
+
+// WriteSPDXTagValue writes the SBOM as an SPDX 2.3 tag-value document.
+func (b *SBOM) WriteSPDXTagValue(w io.Writer) error {
+	doc := b.spdx()
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "SPDXVersion: %s\n", doc.SPDXVersion)
+	fmt.Fprintf(&out, "DataLicense: %s\n", doc.DataLicense)
+	fmt.Fprintf(&out, "SPDXID: %s\n", doc.SPDXID)
+	fmt.Fprintf(&out, "DocumentName: %s\n", doc.Name)
+	fmt.Fprintf(&out, "DocumentNamespace: %s\n", doc.DocumentNamespace)
+	for _, creator := range doc.CreationInfo.Creators {
+		fmt.Fprintf(&out, "Creator: %s\n", creator)
+	}
+	fmt.Fprintf(&out, "Created: %s\n", doc.CreationInfo.Created)
+
+	for _, p := range doc.Packages {
+		fmt.Fprintf(&out, "\n##### Package: %s\n\n", p.Name)
+		fmt.Fprintf(&out, "PackageName: %s\n", p.Name)
+		fmt.Fprintf(&out, "SPDXID: %s\n", p.SPDXID)
+		if p.VersionInfo != "" {
+			fmt.Fprintf(&out, "PackageVersion: %s\n", p.VersionInfo)
+		}
+		fmt.Fprintf(&out, "PackageDownloadLocation: %s\n", p.DownloadLocation)
+		fmt.Fprintf(&out, "FilesAnalyzed: %t\n", p.FilesAnalyzed)
+		fmt.Fprintf(&out, "PackageLicenseConcluded: %s\n", p.LicenseConcluded)
+		fmt.Fprintf(&out, "PackageLicenseDeclared: %s\n", p.LicenseDeclared)
+		if p.LicenseComments != "" {
+			fmt.Fprintf(&out, "PackageLicenseComments: <text>%s</text>\n", p.LicenseComments)
+		}
+		if p.CopyrightText != spdxNoAssertion {
+			fmt.Fprintf(&out, "PackageCopyrightText: <text>%s</text>\n", p.CopyrightText)
+		} else {
+			fmt.Fprintf(&out, "PackageCopyrightText: %s\n", p.CopyrightText)
+		}
+		if p.Comment != "" {
+			fmt.Fprintf(&out, "PackageComment: <text>%s</text>\n", p.Comment)
+		}
+		for _, ref := range p.ExternalRefs {
+			fmt.Fprintf(&out, "ExternalRef: %s %s %s\n", ref.ReferenceCategory, ref.ReferenceType, ref.ReferenceLocator)
+		}
+	}
+
+	out.WriteString("\n")
+	for _, r := range doc.Relationships {
+		fmt.Fprintf(&out, "Relationship: %s %s %s\n", r.SPDXElementID, r.RelationshipType, r.RelatedSPDXElement)
+	}
+
+	for _, l := range doc.ExtractedLicensingInfos {
+		fmt.Fprintf(&out, "\n##### Other license: %s\n\n", l.LicenseID)
+		fmt.Fprintf(&out, "LicenseID: %s\n", l.LicenseID)
+		fmt.Fprintf(&out, "ExtractedText: <text>%s</text>\n", l.ExtractedText)
+		fmt.Fprintf(&out, "LicenseName: %s\n", l.Name)
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func (b *SBOM) spdx() spdxDocument {
+	// The main module has no version in the build list. The modules of a
+	// workspace are all main modules, and are all described.
+	var described []string
+	for _, m := range b.Modules {
+		if m.Main {
+			described = append(described, spdxID(m))
+		}
+	}
+	if len(described) == 0 {
+		described = []string{spdxID(b.Root)}
+	}
+
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              b.Root.Path,
+		DocumentNamespace: b.spdxNamespace(),
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: go-providence-checker"},
+		},
+		DocumentDescribes: described,
+		Packages:          []spdxPackage{},
+		Relationships:     []spdxRelationship{},
+	}
+	for _, id := range described {
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: id,
+		})
+	}
+
+	ids := make(map[string]string)
+	for _, m := range b.Modules {
+		ids[modKey(m)] = spdxID(m)
+		doc.Packages = append(doc.Packages, b.spdxPackage(m))
+	}
+	doc.ExtractedLicensingInfos = b.spdxExtractedLicenses(doc.Packages)
+
+	var froms []string
+	for from := range b.Graph {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	for _, from := range froms {
+		fromID, ok := ids[from]
+		if !ok {
+			continue
+		}
+		for _, to := range b.Graph[from] {
+			toID, ok := ids[to]
+			if !ok {
+				continue
+			}
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      fromID,
+				RelationshipType:   "DEPENDS_ON",
+				RelatedSPDXElement: toID,
+			})
+		}
+	}
+
+	return doc
+}
+
+func (b *SBOM) spdxPackage(m GoModuleInfo) spdxPackage {
+	p := spdxPackage{
+		Name:             m.Path,
+		SPDXID:           spdxID(m),
+		VersionInfo:      m.Version,
+		DownloadLocation: spdxNoAssertion,
+		LicenseConcluded: spdxNoAssertion,
+		LicenseDeclared:  spdxNoAssertion,
+		CopyrightText:    spdxNoAssertion,
+	}
+
+	src := source(m)
+	if loc := downloadLocation(m); loc != "" {
+		p.DownloadLocation = loc
+	}
+	// The go.sum checksum is a hash of the file tree of the module, not of
+	// the zip at the download location, so it isn't a package checksum.
+	var comments []string
+	if m.Replace != nil {
+		comments = append(comments, fmt.Sprintf("replaced by %s", ModuleVersion{Path: src.Path, Version: src.Version}))
+	}
+	if src.Sum != "" {
+		comments = append(comments, fmt.Sprintf("go.sum checksum %s", src.Sum))
+	}
+	p.Comment = strings.Join(comments, "\n")
+	if src.Version != "" {
+		p.ExternalRefs = []spdxExternalRef{{
+			ReferenceCategory: "PACKAGE-MANAGER",
+			ReferenceType:     "purl",
+			ReferenceLocator:  purl(src),
+		}}
+	}
+	li, ok := b.Licenses[modKey(m)]
+	if ok && validSPDXExpression(li.LicenseName, b.Custom) {
+		p.LicenseConcluded = li.LicenseName
+	}
+	if ok && li.ManuallyAsserted {
+		p.LicenseComments = "manually asserted"
+	}
+	if ok && len(li.Copyrights) > 0 {
+		p.CopyrightText = strings.Join(li.Copyrights, "\n")
+	}
+
+	return p
+}
+
+// spdxID returns an SPDX identifier such as
+// "SPDXRef-Package-github.com-spf13-cobra-v1.1.1". SPDX identifiers may
+// only contain letters, numbers, dots and dashes.
+func spdxID(m GoModuleInfo) string {
+	return "SPDXRef-Package-" + spdxInvalidIDChars.ReplaceAllString(modKey(m), "-")
+}
+
+// spdxNamespace returns a document namespace that is unique to the set of
+// modules the SBOM describes.
+func (b *SBOM) spdxNamespace() string {
+	h := sha256.New()
+	for _, m := range b.Modules {
+		fmt.Fprintf(h, "%s %s\n", modKey(m), source(m).Sum)
+	}
+	return fmt.Sprintf("https://spdx.org/spdxdocs/go-providence-checker/%s-%s", b.Root.Path, hex.EncodeToString(h.Sum(nil))[:16])
+}
+
+// validSPDXExpression returns true when every license of the expression,
+// such as "(MIT OR Apache-2.0) AND BSD-3-Clause", is on the SPDX license
+// list or is a custom license with a "LicenseRef-" id, and every exception
+// that follows WITH is on the SPDX exception list.
+func validSPDXExpression(expr string, custom []CustomLicense) bool {
+	tokens := spdxTokens(expr)
+	for i, token := range tokens {
+		switch {
+		case token == "AND" || token == "OR" || token == "WITH":
+			continue
+		case i > 0 && tokens[i-1] == "WITH":
+			if _, found := spdxExceptionIDs[token]; !found {
+				return false
+			}
+		case spdxLicenseRef.MatchString(token):
+			if _, found := findCustomLicense(custom, token); !found {
+				return false
+			}
+		case !isSPDXLicenseID(token):
+			return false
+		}
+	}
+	return len(tokens) > 0
+}
+
+func spdxTokens(expr string) []string {
+	return strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(expr))
+}
+
+// spdxExtractedLicenses returns the custom licenses that the packages refer
+// to, along with their text.
+func (b *SBOM) spdxExtractedLicenses(packages []spdxPackage) []spdxExtractedLicense {
+	var refs []string
+	seen := make(map[string]struct{})
+	for _, p := range packages {
+		for _, token := range spdxTokens(p.LicenseConcluded) {
+			if _, found := seen[token]; found || !spdxLicenseRef.MatchString(token) {
+				continue
+			}
+			seen[token] = struct{}{}
+			refs = append(refs, token)
+		}
+	}
+	sort.Strings(refs)
+
+	var extracted []spdxExtractedLicense
+	for _, ref := range refs {
+		l, _ := findCustomLicense(b.Custom, ref)
+		extracted = append(extracted, spdxExtractedLicense{LicenseID: l.ID, ExtractedText: l.Text, Name: l.ID})
+	}
+	return extracted
+}
@@ -9,7 +9,9 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	classifier "github.com/google/licenseclassifier/v2"
 	"github.com/jakexks/go-providence-checker/pkg/dirutil"
@@ -19,16 +21,124 @@ import (
 
 type State struct {
 	Log                         *zap.SugaredLogger
-	classifier                  *classifier.Classifier
+	classifier                  *lazyClassifier
 	goPath, goCache, workingDir string
+
+	// When local is true, the workingDir is the user's own checkout and
+	// must not be removed by Cleanup.
+	local bool
+	root  GoModuleInfo
+
+	// When fromBinary is true, the modules come from the build info of a
+	// compiled binary or of the binaries of an image and there is no go.mod
+	// in the workingDir. The graph is then built from the build info.
+	fromBinary bool
+	graph      map[string][]string
+
+	overrides []Override
+
+	// The classification results are cached unless cache is nil. The
+	// corpus identifies the license texts known to the licenseclassifier.
+	cache  *Cache
+	corpus string
+
+	// The license texts of extraLicensesDir and the custom licenses are
+	// known to the licenseclassifier in addition to the embedded corpus.
+	extraLicensesDir string
+	custom           []CustomLicense
+
+	// The licenses found with a confidence above the threshold are
+	// reported in addition to the license with the highest confidence.
+	threshold float64
+
+	// The target platform and build tags used when listing packages. The
+	// host's platform is used when empty.
+	goos, goarch, tags string
+
+	// When offline is true, the go command never accesses the network and
+	// the modules come from the user's module cache, goModCache, or from
+	// the vendor directory of the root module as given by vendored.
+	offline    bool
+	goModCache string
+	vendored   map[string]string
+
+	// When vendor is true, the modules are read from vendor/modules.txt
+	// and their Dir points into the vendor directory of the root module.
+	vendor        bool
+	vendorModules []GoModuleInfo
+
+	// When workFile is set, the root is the workspace of this go.work
+	// file and workspace holds the modules that it uses.
+	workFile  string
+	workspace []GoModuleInfo
 }
 
-// rootMod is of the form "github.com/apache/thrift@v0.13.0".
+// rootMod is either of the form "github.com/apache/thrift@v0.13.0", a
+// path to a local directory containing a go.mod, such as "./" or
+// "/src/cert-manager", or a path to a go.work file.
 func (s *State) Init(rootMod string) error {
 	if !viper.GetBool("force") {
 		defer s.Cleanup()
 	}
 
+	if err := s.setup(); err != nil {
+		return err
+	}
+
+	if s.vendor && !IsLocalPath(rootMod) {
+		return fmt.Errorf("the root module %s must be a local directory with --vendor since the downloaded modules have no vendor directory", rootMod)
+	}
+	if s.vendor && IsWorkspace(rootMod) {
+		return fmt.Errorf("the workspace %s can't be used with --vendor", rootMod)
+	}
+
+	switch {
+	case IsWorkspace(rootMod):
+		if err := s.initWorkspace(rootMod); err != nil {
+			return err
+		}
+	case IsLocalPath(rootMod):
+		if err := s.initLocal(rootMod); err != nil {
+			return err
+		}
+	default:
+		if err := s.initDownload(rootMod); err != nil {
+			return err
+		}
+	}
+
+	// The vendored modules, including the local replacements, are all in
+	// the vendor directory.
+	if s.vendor {
+		return nil
+	}
+
+	// The replace directives of a workspace are used in place, so there
+	// is nothing to resolve.
+	if s.workFile == "" {
+		if err := s.resolveReplaces(s.root.Dir); err != nil {
+			return fmt.Errorf("while resolving the replace directives of the root module %s: %w", rootMod, err)
+		}
+	}
+
+	if s.offline {
+		s.vendored = vendoredModules(s.workingDir)
+		return s.checkOffline()
+	}
+
+	s.Log.Info("downloading transitive dependencies")
+	cmd := s.buildCmd("go", "mod", "download")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		s.Log.Errorf("module %s: command 'go mod download' in directory '%s': %s.\nThe stderr and stdout were:\n%s\n. Use --force to ignore.", rootMod, s.workingDir, string(out), err)
+		os.Exit(1)
+	}
+
+	return nil
+}
+
+// setup reads the settings and prepares the temporary GOCACHE.
+func (s *State) setup() error {
 	var opts []zap.Option
 	if viper.GetBool("debug") {
 		opts = append(opts, zap.IncreaseLevel(zap.DebugLevel))
@@ -39,19 +149,91 @@ func (s *State) Init(rootMod string) error {
 		return err
 	}
 	s.Log = logger.Sugar()
+	s.classifier = &lazyClassifier{}
+
+	s.threshold = viper.GetFloat64("license-threshold")
+	s.goos = viper.GetString("goos")
+	s.goarch = viper.GetString("goarch")
+	s.tags = viper.GetString("tags")
+	s.offline = viper.GetBool("offline")
+	s.vendor = viper.GetBool("vendor")
+
+	if path := viper.GetString("overrides"); path != "" {
+		s.overrides, err = LoadOverrides(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.extraLicensesDir = viper.GetString("extra-licenses-dir")
+	if s.extraLicensesDir != "" {
+		if err := checkExtraLicensesDir(s.extraLicensesDir); err != nil {
+			return err
+		}
+	}
 
-	c := exec.Command("go", "env", "GOPATH")
+	if path := viper.GetString("custom-licenses"); path != "" {
+		s.custom, err = LoadCustomLicenses(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A broken cache only makes the run slower.
+	if !viper.GetBool("no-cache") {
+		dir := viper.GetString("cache-dir")
+		if dir == "" {
+			dir, err = DefaultCacheDir()
+		}
+		if err == nil {
+			s.corpus, err = corpusDigest(s.extraLicensesDir, s.custom)
+		}
+		if err == nil {
+			s.cache, err = OpenCache(dir)
+		}
+		if err != nil {
+			s.Log.Infof("the classification results won't be cached: %v", err)
+		}
+	}
+
+	c := exec.Command("go", "env", "GOPATH", "GOMODCACHE")
 	bytes, err := c.Output()
 	if err != nil {
-		return fmt.Errorf("while running 'go env GOPATH' to guess your GOPATH: %w", err)
+		return fmt.Errorf("while running 'go env GOPATH GOMODCACHE' to guess your GOPATH: %w", err)
+	}
+	env := strings.Split(strings.TrimSpace(string(bytes)), "\n")
+	s.goPath = strings.TrimSpace(env[0])
+	if len(env) > 1 {
+		s.goModCache = strings.TrimSpace(env[1])
 	}
-	s.goPath = strings.TrimSpace(string(bytes))
 
 	goCache, err := newTempDir()
 	if err != nil {
 		return fmt.Errorf("creating temp dir for storing the temporary GOPATH: %w", err)
 	}
 	s.goCache = goCache
+
+	return nil
+}
+
+// lazyClassifier loads the licenseclassifier the first time it is needed.
+// It is shared by the copies of the State and is safe for concurrent use.
+type lazyClassifier struct {
+	once       sync.Once
+	classifier *classifier.Classifier
+	err        error
+}
+
+func (s *State) loadClassifier() (*classifier.Classifier, error) {
+	s.classifier.once.Do(func() {
+		s.classifier.classifier, s.classifier.err = s.newClassifier()
+	})
+	return s.classifier.classifier, s.classifier.err
+}
+
+// initDownload downloads the root module and copies it into a temporary
+// working directory.
+func (s *State) initDownload(rootMod string) error {
 	workingDir, err := newTempDir()
 	if err != nil {
 		return fmt.Errorf("creating temp working dir: %w", err)
@@ -77,44 +259,76 @@ func (s *State) Init(rootMod string) error {
 	if err != nil {
 		return fmt.Errorf("could not copy the root module's dir '%s' into '%s': %w", rootGoMod.Dir, s.workingDir, err)
 	}
+	s.root = rootGoMod
 
-	s.Log.Info("downloading transitive dependencies")
-	cmd := s.buildCmd("go", "mod", "download")
-	out, err := cmd.CombinedOutput()
+	return nil
+}
+
+// initLocal uses the module found in the local directory dir as the root
+// module. The go.mod and go.sum are used as-is, which means the replace
+// directives are kept intact.
+func (s *State) initLocal(dir string) error {
+	dir, err := filepath.Abs(dir)
 	if err != nil {
-		s.Log.Errorf("module %s: command 'go mod download' in directory '%s': %s.\nThe stderr and stdout were:\n%s\n. Use --force to ignore.", rootMod, workingDir, string(out), err)
-		os.Exit(1)
+		return fmt.Errorf("while resolving the absolute path of '%s': %w", dir, err)
 	}
+	if !dirutil.Exists(filepath.Join(dir, "go.mod")) {
+		return fmt.Errorf("the directory '%s' does not contain a go.mod file", dir)
+	}
+	s.workingDir = dir
+	s.local = true
+
+	s.Log.Infof("using the local root module in dir %s", dir)
 
-	// The licenseclassifier needs the ./licenses folder to be able to
-	// classify licenses. It is available at
-	// https://github.com/google/licenseclassifier, but we can just use the
-	// Go Module cache for that.
-	googleclassifier, err := s.GoDownload("github.com/google/licenseclassifier@bb04aff29e72")
-	if googleclassifier.Dir == "" {
-		return fmt.Errorf("'go mod download -json github.com/google/licenseclassifier@bb04aff29e72 did not return a Dir field. It returned: %#v", googleclassifier)
+	// The go command refuses to list the main module when the vendor
+	// directory is out of sync, so it is checked first.
+	if s.vendor {
+		if err := s.initVendor(); err != nil {
+			return err
+		}
 	}
-	s.classifier = classifier.NewClassifier(0.2)
-	s.classifier.LoadLicenses(googleclassifier.Dir + "/licenses")
-	switch {
-	case errors.Is(err, os.ErrNotExist):
-		return fmt.Errorf("the folder 'licenses' is unexpectedly missing from '%s'", googleclassifier.Dir)
-	case err != nil:
-		return fmt.Errorf("loading licenses from '%s/licenses': %w", googleclassifier.Dir, err)
+
+	rootGoMod, err := s.GoListMain()
+	if err != nil {
+		return fmt.Errorf("while reading the go.mod in '%s': %w", dir, err)
 	}
+	s.root = rootGoMod
 
 	return nil
 }
 
 func (s *State) Cleanup() {
 	os.RemoveAll(s.goCache)
-	os.RemoveAll(s.workingDir)
+	if !s.local {
+		os.RemoveAll(s.workingDir)
+	}
+}
+
+// CustomLicenses returns the licenses of the custom licenses file.
+func (s *State) CustomLicenses() []CustomLicense {
+	return s.custom
+}
+
+// Root returns the module that was given to Init.
+func (s *State) Root() GoModuleInfo {
+	return s.root
+}
+
+// IsLocalPath returns true when the given root module is a path to a local
+// directory rather than a module path. Module paths never start with a dot
+// or a slash.
+func IsLocalPath(rootMod string) bool {
+	return strings.HasPrefix(rootMod, ".") || filepath.IsAbs(rootMod)
 }
 
 func (s *State) Check(module string) error {
-	info, err := s.GoListSingle(module)
-	if err != nil {
-		return fmt.Errorf("while reading go.mod: %w", err)
+	info := s.root
+	if !IsLocalPath(module) {
+		var err error
+		info, err = s.GoListSingle(module)
+		if err != nil {
+			return fmt.Errorf("while reading go.mod: %w", err)
+		}
 	}
 
 	li, err := s.Classify(info)
@@ -157,8 +371,51 @@ func (s *State) GoDownload(module string) (GoModuleInfo, error) {
 	return modules[0], nil
 }
 
-// When no module is given, all the modules will be listed.
+// GoListMain returns the main module, i.e., the module found in the working
+// directory.
+func (s *State) GoListMain() (GoModuleInfo, error) {
+	args := []string{"list", "-m", "-json"}
+	cmd := s.buildCmd("go", args...)
+	out, err := cmd.Output()
+	if err != nil {
+		return GoModuleInfo{}, fmt.Errorf("while running 'go %v': %w", args, err)
+	}
+
+	modules, err := parseGoListJsonOutput(out)
+	if err != nil {
+		return GoModuleInfo{}, fmt.Errorf("parsing the output of 'go %v': %w", args, err)
+	}
+	if len(modules) != 1 {
+		return GoModuleInfo{}, fmt.Errorf("programmer mistake: GoListMain: a single module was expected to be returned")
+	}
+
+	return modules[0], nil
+}
+
+// GoDownloadAll downloads the modules of the form "path@version" at once.
+// The modules that could not be downloaded have their Error field set.
+func (s *State) GoDownloadAll(modules ...string) ([]GoModuleInfo, error) {
+	args := []string{"mod", "download", "-json"}
+	args = append(args, modules...)
+	cmd := s.buildCmd("go", args...)
+
+	// The command fails as soon as one of the modules can't be downloaded,
+	// but the output still tells which ones could.
+	out, err := cmd.Output()
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("while running 'go %v': %w", args, err)
+	}
+
+	return parseGoListJsonOutput(out)
+}
+
+// When no module is given, all the modules will be listed. With --vendor,
+// the modules are those of vendor/modules.txt.
 func (s *State) GoList(modules ...string) ([]GoModuleInfo, error) {
+	if s.vendor {
+		return s.vendorList(modules...)
+	}
+
 	args := []string{"list", "-m", "-json"}
 	args = append(args, modules...)
 	if len(modules) == 0 {
@@ -166,11 +423,22 @@ func (s *State) GoList(modules ...string) ([]GoModuleInfo, error) {
 	}
 	cmd := s.buildCmd("go", args...)
 	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("while running 'go %v': %w: %s", args, err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
 	if err != nil {
 		return nil, fmt.Errorf("while running 'go %v': %w", args, err)
 	}
 
-	return parseGoListJsonOutput(out)
+	infos, err := parseGoListJsonOutput(out)
+	if err != nil {
+		return nil, err
+	}
+	if s.offline {
+		s.useVendored(infos)
+	}
+	return infos, nil
 }
 
 // The go list -json command does not return an actual array of json
@@ -25,6 +25,34 @@ func (s *State) buildCmd(cmd string, args ...string) *exec.Cmd {
 	// The GOCACHE is required because this command is run without a HOME
 	// env. See: https://github.com/golang/go/issues/29267
 	goCmd.Env = append(goCmd.Env, "GO111MODULE=on", "GOCACHE="+s.goCache, "GOPATH="+s.goPath, "PATH="+os.Getenv("PATH"))
+	if s.goModCache != "" {
+		goCmd.Env = append(goCmd.Env, "GOMODCACHE="+s.goModCache)
+	}
+	// A go.work found in a parent directory must not change the build list
+	// of a single root module.
+	if s.workFile != "" {
+		goCmd.Env = append(goCmd.Env, "GOWORK="+s.workFile)
+	} else {
+		goCmd.Env = append(goCmd.Env, "GOWORK=off")
+	}
+	switch {
+	case s.vendor:
+		goCmd.Env = append(goCmd.Env, "GOPROXY=off", "GOFLAGS=-mod=vendor")
+	case s.offline && s.workFile != "":
+		// The workspaces only allow -mod=readonly.
+		goCmd.Env = append(goCmd.Env, "GOPROXY=off")
+	case s.offline:
+		// The modules are taken from the module cache even when there is
+		// a vendor directory. The go.mod and go.sum, which may be the
+		// user's own, are never rewritten.
+		goCmd.Env = append(goCmd.Env, "GOPROXY=off", "GOFLAGS=-mod=readonly")
+	}
+	if s.goos != "" {
+		goCmd.Env = append(goCmd.Env, "GOOS="+s.goos)
+	}
+	if s.goarch != "" {
+		goCmd.Env = append(goCmd.Env, "GOARCH="+s.goarch)
+	}
 	s.Log.Debugf(PrettyCommand(cmd, args...))
 	return goCmd
 }
@@ -52,4 +80,26 @@ type GoModuleInfo struct {
 	Dir       string `json:"Dir"`
 	GoMod     string `json:"GoMod"`
 	GoVersion string `json:"GoVersion"`
+
+	// Sum is the module's checksum as found in go.sum, e.g.
+	// "h1:V7yhSDDn8LP4lc4jS8pFkt0zCnzVJlG5JXy9BVKJUX0=".
+	Sum string `json:"Sum"`
+
+	// Error is set by 'go mod download -json' when the module could not
+	// be downloaded.
+	Error string `json:"Error"`
+
+	// Replace is set when the module is replaced by a replace directive
+	// in the root's go.mod. In that case, Dir is the replacement's
+	// directory.
+	Replace *GoModuleInfo `json:"Replace"`
+
+	// Packages are the packages of this module that are built. It is only
+	// set when the analysis is done at the package level.
+	Packages []GoPackageInfo `json:"-"`
+
+	// VendorDirs are the directories of every module vendored along with
+	// this one. Unlike in the module cache, the vendored modules have no
+	// go.mod, so the modules nested in this one are only known from them.
+	VendorDirs map[string]struct{} `json:"-"`
 }
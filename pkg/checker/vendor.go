@@ -0,0 +1,299 @@
+package checker
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jakexks/go-providence-checker/pkg/dirutil"
+)
+
+// vendorModule is a module of vendor/modules.txt. The lines that give the
+// modules are of the form:
+//
+//	# github.com/foo/bar v1.2.3
+//	# github.com/foo/bar v1.2.3 => github.com/fork/bar v1.2.4
+//	# github.com/foo/bar v1.2.3 => ../bar
+//	## explicit; go 1.17
+//	github.com/foo/bar
+//	github.com/foo/bar/baz
+//
+// where "## explicit" tells that the module is required in go.mod, and
+// the lines that follow are the vendored packages. The replacements that
+// apply to every version are given by lines such as "# github.com/foo/bar
+// => ../bar", with no version and no package.
+type vendorModule struct {
+	Path, Version string
+	Replace       ModuleVersion
+	Explicit      bool
+	GoVersion     string
+	Packages      []string
+}
+
+// readVendorModules parses the vendor/modules.txt of the root module. It
+// also returns the replacements that apply to every version, keyed by the
+// path of the replaced module. An error wrapping os.ErrNotExist is
+// returned when there is no vendor directory.
+func readVendorModules(rootDir string) ([]vendorModule, map[string]ModuleVersion, error) {
+	path := filepath.Join(rootDir, "vendor", "modules.txt")
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("while reading '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	var modules []vendorModule
+	wildcards := make(map[string]ModuleVersion)
+	var current *vendorModule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "## "):
+			if current == nil {
+				continue
+			}
+			for _, annotation := range strings.Split(strings.TrimPrefix(line, "## "), ";") {
+				annotation = strings.TrimSpace(annotation)
+				switch {
+				case annotation == "explicit":
+					current.Explicit = true
+				case strings.HasPrefix(annotation, "go "):
+					current.GoVersion = strings.TrimPrefix(annotation, "go ")
+				}
+			}
+		case strings.HasPrefix(line, "# "):
+			current = nil
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) >= 4 && fields[2] == "=>":
+				wildcards[fields[1]] = ModuleVersion{Path: fields[3], Version: strings.Join(fields[4:], "")}
+			case len(fields) >= 3:
+				m := vendorModule{Path: fields[1], Version: fields[2]}
+				if len(fields) >= 5 && fields[3] == "=>" {
+					m.Replace = ModuleVersion{Path: fields[4], Version: strings.Join(fields[5:], "")}
+				}
+				modules = append(modules, m)
+				current = &modules[len(modules)-1]
+			default:
+				return nil, nil, fmt.Errorf("while reading '%s': unexpected line '%s'", path, line)
+			}
+		case line != "" && current != nil:
+			current.Packages = append(current.Packages, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("while reading '%s': %w", path, err)
+	}
+	return modules, wildcards, nil
+}
+
+// vendoredModules returns the directory of each module vendored in the
+// root module, keyed by "path@version". A module replaced by another
+// module is also keyed by the replacement's "path@version" since that is
+// what the go command reports. Nothing is returned when there is no vendor
+// directory.
+func vendoredModules(rootDir string) map[string]string {
+	modules, _, err := readVendorModules(rootDir)
+	if err != nil {
+		return nil
+	}
+	vendored := make(map[string]string)
+	for _, m := range modules {
+		dir := filepath.Join(rootDir, "vendor", filepath.FromSlash(m.Path))
+		if !dirutil.Exists(dir) {
+			continue
+		}
+		vendored[m.Path+"@"+m.Version] = dir
+		if m.Replace.Version != "" {
+			vendored[m.Replace.Path+"@"+m.Replace.Version] = dir
+		}
+	}
+	return vendored
+}
+
+// initVendor reads the modules from vendor/modules.txt instead of the
+// module cache, after making sure that the vendor directory is in sync with
+// go.mod. The modules that have no vendored package are left out since
+// they are not built.
+func (s *State) initVendor() error {
+	vendored, wildcards, err := readVendorModules(s.workingDir)
+	if err != nil {
+		return err
+	}
+	gomod, err := s.GoModEdit()
+	if err != nil {
+		return err
+	}
+	if err := checkVendorSync(gomod, vendored, wildcards); err != nil {
+		return err
+	}
+	sums, err := readGoSum(s.workingDir)
+	if err != nil {
+		return err
+	}
+
+	// The modules may be nested in one another, such as
+	// cloud.google.com/go/storage in cloud.google.com/go.
+	dirs := make(map[string]struct{})
+	for _, v := range vendored {
+		dirs[filepath.Join(s.workingDir, "vendor", filepath.FromSlash(v.Path))] = struct{}{}
+	}
+
+	s.vendorModules = nil
+	for _, v := range vendored {
+		dir := filepath.Join(s.workingDir, "vendor", filepath.FromSlash(v.Path))
+		if len(v.Packages) == 0 || !dirutil.Exists(dir) {
+			continue
+		}
+		m := GoModuleInfo{Path: v.Path, Version: v.Version, Dir: dir, GoVersion: v.GoVersion, VendorDirs: dirs}
+		replace := v.Replace
+		if replace.Path == "" {
+			replace = wildcards[v.Path]
+		}
+		switch {
+		case replace.Path == "":
+			m.Sum = sums[v.Path+"@"+v.Version]
+		default:
+			m.Replace = &GoModuleInfo{Path: replace.Path, Version: replace.Version, Dir: dir}
+			if replace.Version != "" {
+				m.Replace.Sum = sums[replace.Path+"@"+replace.Version]
+			}
+		}
+		s.vendorModules = append(s.vendorModules, m)
+	}
+	s.Log.Infof("using the %d modules vendored in %s", len(s.vendorModules), filepath.Join(s.workingDir, "vendor"))
+	return nil
+}
+
+// checkVendorSync returns an error listing the differences between go.mod
+// and vendor/modules.txt, like the go command does before building with
+// -mod=vendor. The explicit requirements can only be checked when
+// modules.txt records them, which is the case since Go 1.14.
+func checkVendorSync(gomod GoMod, vendored []vendorModule, wildcards map[string]ModuleVersion) error {
+	byPath := make(map[string]vendorModule)
+	annotated := false
+	for _, v := range vendored {
+		byPath[v.Path] = v
+		if v.Explicit {
+			annotated = true
+		}
+	}
+
+	var problems []string
+	required := make(map[string]struct{})
+	for _, r := range gomod.Require {
+		required[r.Path] = struct{}{}
+		v, found := byPath[r.Path]
+		switch {
+		case !found && annotated:
+			problems = append(problems, fmt.Sprintf("%s is required in go.mod but is not in vendor/modules.txt", r))
+		case !found:
+			continue
+		case v.Version != r.Version:
+			problems = append(problems, fmt.Sprintf("%s is required in go.mod but %s is vendored", r, ModuleVersion{Path: v.Path, Version: v.Version}))
+		case annotated && !v.Explicit:
+			problems = append(problems, fmt.Sprintf("%s is required in go.mod but is not marked as explicit in vendor/modules.txt", r))
+		}
+	}
+	for _, v := range vendored {
+		if _, found := required[v.Path]; v.Explicit && !found {
+			problems = append(problems, fmt.Sprintf("%s is marked as explicit in vendor/modules.txt but is not required in go.mod", ModuleVersion{Path: v.Path, Version: v.Version}))
+		}
+	}
+
+	// The replacements of go.mod must be those of modules.txt.
+	replaced := make(map[string]ModuleVersion)
+	for _, r := range gomod.Replace {
+		replaced[r.Old.String()] = r.New
+	}
+	vendorReplaced := make(map[string]ModuleVersion)
+	for path, r := range wildcards {
+		vendorReplaced[path] = r
+	}
+	for _, v := range vendored {
+		if v.Replace.Path == "" {
+			continue
+		}
+		key := ModuleVersion{Path: v.Path, Version: v.Version}.String()
+		if _, found := replaced[key]; !found {
+			if _, found := replaced[v.Path]; found {
+				key = v.Path
+			}
+		}
+		vendorReplaced[key] = v.Replace
+	}
+	for old, r := range replaced {
+		v, found := vendorReplaced[old]
+		switch {
+		case !found:
+			// Go only records the replacements of the vendored modules.
+			if _, vendoredPath := byPath[strings.Split(old, "@")[0]]; vendoredPath {
+				problems = append(problems, fmt.Sprintf("%s is replaced in go.mod by %s but not in vendor/modules.txt", old, r))
+			}
+		case v != r:
+			problems = append(problems, fmt.Sprintf("%s is replaced in go.mod by %s but in vendor/modules.txt by %s", old, r, v))
+		}
+	}
+	for old, v := range vendorReplaced {
+		if _, found := replaced[old]; !found {
+			problems = append(problems, fmt.Sprintf("%s is replaced in vendor/modules.txt by %s but not in go.mod", old, v))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("the vendor directory is out of sync with go.mod, run 'go mod vendor' to fix it:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// readGoSum returns the checksums of the modules found in the go.sum of
+// the root module, keyed by "path@version". The checksums of the go.mod
+// files are left out.
+func readGoSum(rootDir string) (map[string]string, error) {
+	sums := make(map[string]string)
+	content, err := ioutil.ReadFile(filepath.Join(rootDir, "go.sum"))
+	switch {
+	case os.IsNotExist(err):
+		return sums, nil
+	case err != nil:
+		return nil, fmt.Errorf("while reading the go.sum: %w", err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		sums[fields[0]+"@"+fields[1]] = fields[2]
+	}
+	return sums, nil
+}
+
+// vendorList returns the main module and the vendored modules, or only the
+// vendored modules given as "path" or "path@version".
+func (s *State) vendorList(modules ...string) ([]GoModuleInfo, error) {
+	if len(modules) == 0 {
+		return append([]GoModuleInfo{s.root}, s.vendorModules...), nil
+	}
+
+	var infos []GoModuleInfo
+	for _, module := range modules {
+		found := false
+		for _, m := range append([]GoModuleInfo{s.root}, s.vendorModules...) {
+			if module == m.Path || module == m.Path+"@"+m.Version {
+				infos = append(infos, m)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("the module %s is not vendored", module)
+		}
+	}
+	return infos, nil
+}
@@ -0,0 +1,257 @@
+package checker
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadVendorModules(t *testing.T) {
+	tests := []struct {
+		name          string
+		modulesTxt    string
+		wantModules   []vendorModule
+		wantWildcards map[string]ModuleVersion
+		wantErr       bool
+	}{
+		{
+			name: "modules with packages and annotations",
+			modulesTxt: `# github.com/foo/bar v1.2.3
+## explicit; go 1.17
+github.com/foo/bar
+github.com/foo/bar/baz
+# github.com/foo/indirect v0.1.0
+github.com/foo/indirect
+`,
+			wantModules: []vendorModule{
+				{Path: "github.com/foo/bar", Version: "v1.2.3", Explicit: true, GoVersion: "1.17", Packages: []string{"github.com/foo/bar", "github.com/foo/bar/baz"}},
+				{Path: "github.com/foo/indirect", Version: "v0.1.0", Packages: []string{"github.com/foo/indirect"}},
+			},
+			wantWildcards: map[string]ModuleVersion{},
+		},
+		{
+			name: "replacements",
+			modulesTxt: `# github.com/foo/bar v1.2.3 => github.com/fork/bar v1.2.4
+## explicit
+github.com/foo/bar
+# github.com/foo/local v0.0.0 => ../local
+github.com/foo/local
+# github.com/foo/wild => ../wild
+`,
+			wantModules: []vendorModule{
+				{Path: "github.com/foo/bar", Version: "v1.2.3", Replace: ModuleVersion{Path: "github.com/fork/bar", Version: "v1.2.4"}, Explicit: true, Packages: []string{"github.com/foo/bar"}},
+				{Path: "github.com/foo/local", Version: "v0.0.0", Replace: ModuleVersion{Path: "../local"}, Packages: []string{"github.com/foo/local"}},
+			},
+			wantWildcards: map[string]ModuleVersion{
+				"github.com/foo/wild": {Path: "../wild"},
+			},
+		},
+		{
+			name: "module without package",
+			modulesTxt: `# github.com/foo/bar v1.2.3
+## explicit
+`,
+			wantModules: []vendorModule{
+				{Path: "github.com/foo/bar", Version: "v1.2.3", Explicit: true},
+			},
+			wantWildcards: map[string]ModuleVersion{},
+		},
+		{
+			name:       "malformed module line",
+			modulesTxt: "# github.com/foo/bar\n",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, filepath.Join(dir, "vendor", "modules.txt"), tt.modulesTxt)
+
+			modules, wildcards, err := readVendorModules(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readVendorModules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(modules, tt.wantModules) {
+				t.Errorf("readVendorModules() modules = %+v, want %+v", modules, tt.wantModules)
+			}
+			if !reflect.DeepEqual(wildcards, tt.wantWildcards) {
+				t.Errorf("readVendorModules() wildcards = %+v, want %+v", wildcards, tt.wantWildcards)
+			}
+		})
+	}
+}
+
+func TestReadVendorModulesNoVendor(t *testing.T) {
+	_, _, err := readVendorModules(t.TempDir())
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("readVendorModules() error = %v, want an error wrapping os.ErrNotExist", err)
+	}
+}
+
+func TestCheckVendorSync(t *testing.T) {
+	bar := ModuleVersion{Path: "github.com/foo/bar", Version: "v1.2.3"}
+	tests := []struct {
+		name      string
+		gomod     GoMod
+		vendored  []vendorModule
+		wildcards map[string]ModuleVersion
+		wantErrs  []string
+	}{
+		{
+			name:     "in sync",
+			gomod:    GoMod{Require: []ModuleVersion{bar}},
+			vendored: []vendorModule{{Path: bar.Path, Version: bar.Version, Explicit: true}},
+		},
+		{
+			name: "in sync with replacements",
+			gomod: GoMod{
+				Require: []ModuleVersion{bar},
+				Replace: []GoModReplace{
+					{Old: bar, New: ModuleVersion{Path: "github.com/fork/bar", Version: "v1.2.4"}},
+					{Old: ModuleVersion{Path: "github.com/foo/wild"}, New: ModuleVersion{Path: "../wild"}},
+				},
+			},
+			vendored:  []vendorModule{{Path: bar.Path, Version: bar.Version, Explicit: true, Replace: ModuleVersion{Path: "github.com/fork/bar", Version: "v1.2.4"}}},
+			wildcards: map[string]ModuleVersion{"github.com/foo/wild": {Path: "../wild"}},
+		},
+		{
+			name:     "wildcard replacement recorded on the module line",
+			gomod:    GoMod{Require: []ModuleVersion{bar}, Replace: []GoModReplace{{Old: ModuleVersion{Path: bar.Path}, New: ModuleVersion{Path: "../bar"}}}},
+			vendored: []vendorModule{{Path: bar.Path, Version: bar.Version, Explicit: true, Replace: ModuleVersion{Path: "../bar"}}},
+		},
+		{
+			name:     "pre-1.14 modules.txt without annotations",
+			gomod:    GoMod{Require: []ModuleVersion{bar, {Path: "github.com/foo/unused", Version: "v1.0.0"}}},
+			vendored: []vendorModule{{Path: bar.Path, Version: bar.Version}},
+		},
+		{
+			name:     "missing module",
+			gomod:    GoMod{Require: []ModuleVersion{bar, {Path: "github.com/foo/other", Version: "v1.0.0"}}},
+			vendored: []vendorModule{{Path: bar.Path, Version: bar.Version, Explicit: true}},
+			wantErrs: []string{"github.com/foo/other@v1.0.0 is required in go.mod but is not in vendor/modules.txt"},
+		},
+		{
+			name:     "other version vendored",
+			gomod:    GoMod{Require: []ModuleVersion{bar}},
+			vendored: []vendorModule{{Path: bar.Path, Version: "v1.2.2", Explicit: true}},
+			wantErrs: []string{"github.com/foo/bar@v1.2.3 is required in go.mod but github.com/foo/bar@v1.2.2 is vendored"},
+		},
+		{
+			name:  "explicit mismatch",
+			gomod: GoMod{Require: []ModuleVersion{bar}},
+			vendored: []vendorModule{
+				{Path: bar.Path, Version: bar.Version},
+				{Path: "github.com/foo/dropped", Version: "v1.0.0", Explicit: true},
+			},
+			wantErrs: []string{
+				"github.com/foo/bar@v1.2.3 is required in go.mod but is not marked as explicit in vendor/modules.txt",
+				"github.com/foo/dropped@v1.0.0 is marked as explicit in vendor/modules.txt but is not required in go.mod",
+			},
+		},
+		{
+			name:     "replacement missing from modules.txt",
+			gomod:    GoMod{Require: []ModuleVersion{bar}, Replace: []GoModReplace{{Old: bar, New: ModuleVersion{Path: "../bar"}}}},
+			vendored: []vendorModule{{Path: bar.Path, Version: bar.Version, Explicit: true}},
+			wantErrs: []string{"github.com/foo/bar@v1.2.3 is replaced in go.mod by ../bar but not in vendor/modules.txt"},
+		},
+		{
+			name:     "replacement of a module that is not vendored",
+			gomod:    GoMod{Require: []ModuleVersion{bar}, Replace: []GoModReplace{{Old: ModuleVersion{Path: "github.com/foo/unused"}, New: ModuleVersion{Path: "../unused"}}}},
+			vendored: []vendorModule{{Path: bar.Path, Version: bar.Version, Explicit: true}},
+		},
+		{
+			name:     "different replacement",
+			gomod:    GoMod{Require: []ModuleVersion{bar}, Replace: []GoModReplace{{Old: bar, New: ModuleVersion{Path: "../bar"}}}},
+			vendored: []vendorModule{{Path: bar.Path, Version: bar.Version, Explicit: true, Replace: ModuleVersion{Path: "../fork"}}},
+			wantErrs: []string{"github.com/foo/bar@v1.2.3 is replaced in go.mod by ../bar but in vendor/modules.txt by ../fork"},
+		},
+		{
+			name:      "replacement missing from go.mod",
+			gomod:     GoMod{Require: []ModuleVersion{bar}},
+			vendored:  []vendorModule{{Path: bar.Path, Version: bar.Version, Explicit: true}},
+			wildcards: map[string]ModuleVersion{"github.com/foo/wild": {Path: "../wild"}},
+			wantErrs:  []string{"github.com/foo/wild is replaced in vendor/modules.txt by ../wild but not in go.mod"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVendorSync(tt.gomod, tt.vendored, tt.wildcards)
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("checkVendorSync() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("checkVendorSync() error = nil, want %q", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("checkVendorSync() error = %v, want it to contain %q", err, want)
+				}
+			}
+			if got := strings.Count(err.Error(), "\n  "); got != len(tt.wantErrs) {
+				t.Errorf("checkVendorSync() reported %d problems, want %d: %v", got, len(tt.wantErrs), err)
+			}
+		})
+	}
+}
+
+func TestReadGoSum(t *testing.T) {
+	tests := []struct {
+		name  string
+		gosum *string
+		want  map[string]string
+	}{
+		{
+			name: "go.mod checksums are left out",
+			gosum: strPtr(`github.com/foo/bar v1.2.3 h1:abc=
+github.com/foo/bar v1.2.3/go.mod h1:def=
+github.com/foo/baz v0.1.0/go.mod h1:ghi=
+
+`),
+			want: map[string]string{"github.com/foo/bar@v1.2.3": "h1:abc="},
+		},
+		{
+			name:  "no go.sum",
+			gosum: nil,
+			want:  map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.gosum != nil {
+				writeTestFile(t, filepath.Join(dir, "go.sum"), *tt.gosum)
+			}
+			got, err := readGoSum(dir)
+			if err != nil {
+				t.Fatalf("readGoSum() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readGoSum() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,77 @@
+package checker
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/jakexks/go-providence-checker/pkg/dirutil"
+)
+
+// IsWorkspace returns true when the given root module is a go.work file, or
+// a local directory that contains a go.work file but no go.mod.
+func IsWorkspace(rootMod string) bool {
+	if !IsLocalPath(rootMod) {
+		return false
+	}
+	if filepath.Base(rootMod) == "go.work" {
+		return true
+	}
+	return dirutil.Exists(filepath.Join(rootMod, "go.work")) && !dirutil.Exists(filepath.Join(rootMod, "go.mod"))
+}
+
+// initWorkspace uses the workspace of the go.work file as the root. The
+// modules of the workspace are its first-party modules, and the go command
+// gives their combined build list. The root has no module path, so the
+// workspace's directory is used instead.
+func (s *State) initWorkspace(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("while resolving the absolute path of '%s': %w", path, err)
+	}
+	if filepath.Base(path) != "go.work" {
+		path = filepath.Join(path, "go.work")
+	}
+	if !dirutil.Exists(path) {
+		return fmt.Errorf("the go.work file '%s' does not exist", path)
+	}
+	s.workFile = path
+	s.workingDir = filepath.Dir(path)
+	s.local = true
+
+	s.Log.Infof("using the workspace %s", path)
+	args := []string{"list", "-m", "-json"}
+	out, err := s.buildCmd("go", args...).Output()
+	if err != nil {
+		return fmt.Errorf("while running 'go %v' to list the modules of the workspace '%s': %w", args, path, err)
+	}
+	s.workspace, err = parseGoListJsonOutput(out)
+	if err != nil {
+		return fmt.Errorf("parsing the output of 'go %v': %w", args, err)
+	}
+	if len(s.workspace) == 0 {
+		return fmt.Errorf("the workspace '%s' does not use any module", path)
+	}
+	s.root = GoModuleInfo{Path: s.workingDir, Main: true, Dir: s.workingDir}
+
+	return nil
+}
+
+// Firstparty returns the modules whose source code is the user's own: the
+// modules of the workspace, or else the root module.
+func (s *State) Firstparty() []GoModuleInfo {
+	if s.workFile != "" {
+		return s.workspace
+	}
+	return []GoModuleInfo{s.root}
+}
+
+// workspaceEdges returns the workspace as depending on each of its modules.
+func (s *State) workspaceEdges() []string {
+	var deps []string
+	for _, m := range s.workspace {
+		deps = append(deps, m.Path)
+	}
+	sort.Strings(deps)
+	return deps
+}
@@ -10,6 +10,12 @@ import (
 )
 
 func CopyDirectory(srcDir, dest string) error {
+	return CopyDirectoryExcept(srcDir, dest)
+}
+
+// CopyDirectoryExcept works like CopyDirectory but skips the files and
+// directories given in except. The paths in except must be absolute.
+func CopyDirectoryExcept(srcDir, dest string, except ...string) error {
 	entries, err := ioutil.ReadDir(srcDir)
 	if err != nil {
 		return fmt.Errorf("listing source directory '%s': %w", srcDir, err)
@@ -18,6 +24,10 @@ func CopyDirectory(srcDir, dest string) error {
 		sourcePath := filepath.Join(srcDir, entry.Name())
 		destPath := filepath.Join(dest, entry.Name())
 
+		if contains(except, sourcePath) {
+			continue
+		}
+
 		fileInfo, err := os.Stat(sourcePath)
 		if err != nil {
 			return fmt.Errorf("stat syscall on the file '%s': %w", sourcePath, err)
@@ -33,7 +43,7 @@ func CopyDirectory(srcDir, dest string) error {
 			if err := CreateIfNotExists(destPath, 0755); err != nil {
 				return fmt.Errorf("creating directory: %w", err)
 			}
-			if err := CopyDirectory(sourcePath, destPath); err != nil {
+			if err := CopyDirectoryExcept(sourcePath, destPath, except...); err != nil {
 				return fmt.Errorf("copying dir '%s' to '%s': %w", sourcePath, destPath, err)
 			}
 		case os.ModeSymlink:
@@ -112,3 +122,12 @@ func CopySymLink(source, dest string) error {
 	}
 	return os.Symlink(link, dest)
 }
+
+func contains(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}